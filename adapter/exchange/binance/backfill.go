@@ -0,0 +1,103 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/binance/binance-connector-go/clients/spot/src/websocketstreams/models"
+)
+
+const aggTradesLimit = 1000
+
+// Backfill pages through the aggTrades REST endpoint for each pair and
+// publishes the trades in [from, to) to the backfill topic. It returns how
+// many trades were published.
+func (b *binance) Backfill(ctx context.Context, pairs []string, from, to time.Time) (int, error) {
+	total := 0
+
+	for _, pair := range pairs {
+		n, err := b.backfillSymbol(ctx, strings.ToUpper(pair), from, to)
+		if err != nil {
+			return total, fmt.Errorf("[adapter][exchange][binance][Backfill][backfillSymbol] pair %s: %w", pair, err)
+		}
+
+		total += n
+	}
+
+	return total, nil
+}
+
+func (b *binance) backfillSymbol(ctx context.Context, symbol string, from, to time.Time) (int, error) {
+	until := to.UnixMilli()
+	windowStart := from.UnixMilli()
+	window := time.Hour.Milliseconds()
+
+	published := 0
+	fromId := int64(-1)
+
+	// startTime/endTime may span at most an hour, so walk hourly windows
+	// until the first trade, then continue by aggregate trade id.
+	for windowStart < until {
+		req := b.client.RestApi.MarketAPI.AggTrades(ctx).Symbol(symbol).Limit(aggTradesLimit)
+		if fromId >= 0 {
+			req = req.FromId(fromId)
+		} else {
+			req = req.StartTime(windowStart).EndTime(min(windowStart+window-1, until))
+		}
+
+		res, err := req.Execute()
+		if err != nil {
+			return published, fmt.Errorf("[adapter][exchange][binance][backfillSymbol][MarketAPI.AggTrades] %w", err)
+		}
+
+		items := res.Data.Items
+
+		if len(items) == 0 {
+			if fromId >= 0 {
+				break
+			}
+
+			windowStart += window
+			continue
+		}
+
+		for _, item := range items {
+			if item.A == nil || item.T == nil {
+				continue
+			}
+
+			if *item.T >= until {
+				return published, nil
+			}
+
+			ta, err := convertAggTrade(models.AggTradeResponse{
+				E:      item.T,
+				S:      &symbol,
+				A:      item.A,
+				P:      item.P,
+				Q:      item.Q,
+				F:      item.F,
+				L:      item.L,
+				T:      item.T,
+				Smallm: item.Smallm,
+				M:      item.M,
+			})
+			if err != nil {
+				return published, fmt.Errorf("[adapter][exchange][binance][backfillSymbol][convertAggTrade] %w", err)
+			}
+
+			b.tradeBackfillTopic.Publish(ta)
+
+			published++
+			fromId = *item.A + 1
+		}
+
+		if fromId >= 0 && len(items) < aggTradesLimit {
+			break
+		}
+	}
+
+	return published, nil
+}
@@ -1,37 +1,102 @@
 package binance
 
 import (
+	"context"
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"michaelyusak/go-market-ingestor.git/bus"
 	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/metrics"
+	"sync"
 
 	client "github.com/binance/binance-connector-go/clients/spot"
+	restModels "github.com/binance/binance-connector-go/clients/spot/src/restapi/models"
 	"github.com/binance/binance-connector-go/common/v2/common"
 )
 
 type binance struct {
-	client          *client.BinanceSpotClient
-	tradeActivityCh []chan entity.TradeActivityV2
+	client             *client.BinanceSpotClient
+	wsConf             *common.ConfigurationWebsocketStreams
+	supervisor         *exchange.Supervisor
+	tradeActivityTopic *bus.Topic[entity.TradeActivityV2]
+	tradeBackfillTopic *bus.Topic[entity.TradeActivityV2]
+	orderBookTopic     *bus.Topic[entity.OrderBook]
+
+	depthMode   string
+	depthLevels int
+
+	fetchDepthSnapshot func(ctx context.Context, symbol string) (restModels.DepthResponse, error)
+
+	sessions map[int]*session
+
+	// maxPairsPerConn sizes the shards; pairsMu serializes changes to the
+	// listened pairs.
+	maxPairsPerConn int
+	pairsMu         sync.Mutex
+
+	// ctx bounds every shard, cancel stops them
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
 }
 
 func NewClient(
-	tradeActivityCh []chan entity.TradeActivityV2,
+	tradeActivityTopic *bus.Topic[entity.TradeActivityV2],
+	tradeBackfillTopic *bus.Topic[entity.TradeActivityV2],
+	orderBookTopic *bus.Topic[entity.OrderBook],
+	depthMode string,
+	depthLevels int,
+	supervisorOpt exchange.SupervisorOpt,
 ) *binance {
 	conf := common.NewConfigurationWebsocketStreams(
 		common.WithWsStreamsBasePath(common.SpotWebsocketStreamsProdUrl),
 	)
 
-	return &binance{
-		client:          client.NewBinanceSpotClient(client.WithWebsocketStreams(conf)),
-		tradeActivityCh: tradeActivityCh,
+	restConf := common.NewConfigurationRestAPI(
+		common.WithBasePath(common.SpotRestApiProdUrl),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &binance{
+		client: client.NewBinanceSpotClient(
+			client.WithRestAPI(restConf),
+		),
+		wsConf:             conf,
+		supervisor:         exchange.NewSupervisor("binance", supervisorOpt),
+		tradeActivityTopic: tradeActivityTopic,
+		tradeBackfillTopic: tradeBackfillTopic,
+		orderBookTopic:     orderBookTopic,
+
+		depthMode:   depthMode,
+		depthLevels: depthLevels,
+
+		sessions: map[int]*session{},
+
+		maxPairsPerConn: 10,
+
+		ctx:    ctx,
+		cancel: cancel,
 	}
+
+	b.fetchDepthSnapshot = b.getDepthSnapshot
+
+	return b
+}
+
+func (b *binance) Supervisor() *exchange.Supervisor {
+	return b.supervisor
 }
 
 func (i *binance) broadcastTradeActivity(ta entity.TradeActivityV2) {
-	for _, ch := range i.tradeActivityCh {
-		select {
-		case ch <- ta:
-			// sent successfully
-		default:
-			// channel not ready, skip or log
-		}
+	metrics.TradesReceived.WithLabelValues(ta.Exchange, ta.Symbol).Inc()
+
+	dropped := i.tradeActivityTopic.Publish(ta)
+	if dropped > 0 {
+		metrics.BroadcastDropped.WithLabelValues(ta.Exchange).Add(float64(dropped))
 	}
 }
+
+func (i *binance) broadcastOrderBook(ob entity.OrderBook) {
+	i.orderBookTopic.Publish(ob)
+}
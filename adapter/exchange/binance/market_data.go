@@ -1,60 +1,238 @@
 package binance
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	client "github.com/binance/binance-connector-go/clients/spot"
+	streams "github.com/binance/binance-connector-go/clients/spot/src/websocketstreams"
 	"github.com/binance/binance-connector-go/clients/spot/src/websocketstreams/models"
 	"github.com/sirupsen/logrus"
 )
 
-func (b *binance) ListenMarketData(id int, pairs []string) error {
-	streams := make([]string, 0, len(pairs))
+const connectionCheckInterval = 5 * time.Second
+
+// ListenMarketData runs one session on its own connection and blocks until
+// the connection fails.
+func (b *binance) ListenMarketData(ctx context.Context, id int, pairs []string) error {
+	streamNames := make([]string, 0, len(pairs))
 
 	for _, s := range pairs {
-		streams = append(
-			streams,
+		streamNames = append(
+			streamNames,
 			strings.ToLower(s),
 		)
 	}
 
-	err := b.client.WebsocketStreams.Connect(streams)
+	ws := client.NewBinanceSpotClient(client.WithWebsocketStreams(b.wsConf)).WebsocketStreams
+
+	err := ws.Connect(streamNames)
 	if err != nil {
 		return fmt.Errorf("[adapter][exchange][binance][ListenMarketData] failed to connect to the streams: %w", err)
 	}
 
-	aggTradeHandler := func(atr models.AggTradeResponse) {
-		logrus.WithField("symbol", *atr.S).Debug("[adapter][exchange][binance][ListenMarketData] new aggTrade message")
-
-		err := b.processAggTrade(atr)
+	defer func() {
+		err := ws.CloseWebSocketStreamConnection()
 		if err != nil {
 			logrus.
 				WithError(err).
-				WithField("symbol", *atr.S).
-				Error("[adapter][exchange][binance][ListenMarketData][messageHandler]")
+				WithField("id", id).
+				Warn("[adapter][exchange][binance][ListenMarketData][ws.CloseWebSocketStreamConnection]")
 		}
+	}()
+
+	sess := &session{
+		id:    id,
+		ws:    ws,
+		pairs: slices.Clone(pairs),
 	}
 
 	for _, s := range pairs {
-		handler, err := b.client.WebsocketStreams.WebSocketStreamsAPI.AggTrade().Symbol(strings.ToLower(s)).Execute()
+		err := b.subscribeAggTrade(sess, s)
 		if err != nil {
-			return fmt.Errorf("[adapter][exchange][binance][ListenMarketData] failed to execute streams: %w", err)
+			return fmt.Errorf("[adapter][exchange][binance][ListenMarketData][subscribeAggTrade] %w", err)
+		}
+	}
+
+	err = b.listenDepth(ws, id, pairs)
+	if err != nil {
+		return fmt.Errorf("[adapter][exchange][binance][ListenMarketData][listenDepth] %w", err)
+	}
+
+	logrus.
+		WithField("id", id).
+		Info("[adapter][exchange][binance][ListenMarketData] market data websocket fully initiated")
+
+	b.supervisor.MarkConnected(id)
+
+	b.setSession(id, sess)
+	defer b.removeSession(id, sess)
+
+	// pairs may have been added or removed while the session was starting
+	b.syncSession(sess)
+
+	err = waitDisconnected(ctx, ws)
+	if err == nil {
+		logrus.
+			WithField("id", id).
+			Info("[adapter][exchange][binance][ListenMarketData] closing market data websocket")
+		return nil
+	}
+
+	return fmt.Errorf("[adapter][exchange][binance][ListenMarketData][waitDisconnected] %w", err)
+}
+
+// waitDisconnected blocks until a connection reports a read error or stops
+// being healthy, or returns nil once ctx is done. The connector does not
+// reconnect after read errors itself.
+func waitDisconnected(ctx context.Context, ws *streams.WebsocketStreamsClient) error {
+	ticker := time.NewTicker(connectionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
 		}
 
-		handler.On("message", aggTradeHandler)
+		for _, conn := range ws.Ws.WsCommon.Connections {
+			select {
+			case err := <-conn.ErrorChan:
+				return err
+			default:
+			}
+
+			if !conn.IsHealthy() {
+				return errors.New("connection closed")
+			}
+		}
+	}
+}
+
+func (b *binance) listenDepth(ws *streams.WebsocketStreamsClient, id int, pairs []string) error {
+	switch b.depthMode {
+	case DepthModeNone:
+		return nil
+	case DepthModePartial:
+		levels := models.PartialBookDepthLevelsParameter(strconv.Itoa(b.depthLevels))
+		if !slices.Contains(models.AllowedPartialBookDepthLevelsParameterEnumValues, levels) {
+			return fmt.Errorf("[adapter][exchange][binance][listenDepth] invalid partial depth levels: %d", b.depthLevels)
+		}
+
+		for _, s := range pairs {
+			symbol := strings.ToUpper(s)
+
+			handler, err := ws.WebSocketStreamsAPI.PartialBookDepth().Symbol(strings.ToLower(s)).Levels(levels).Execute()
+			if err != nil {
+				return fmt.Errorf("[adapter][exchange][binance][listenDepth] failed to execute partial depth streams: %w", err)
+			}
+
+			handler.On("message", func(pbd models.PartialBookDepthResponse) {
+				b.supervisor.RecordMessage(id)
+				err := b.processPartialDepth(symbol, pbd)
+				if err != nil {
+					logrus.
+						WithError(err).
+						WithField("symbol", symbol).
+						Error("[adapter][exchange][binance][listenDepth][partialDepthHandler]")
+				}
+			})
+		}
+	case DepthModeDiff:
+		for _, s := range pairs {
+			book := newDepthBook(strings.ToUpper(s), b.depthLevels)
+
+			handler, err := ws.WebSocketStreamsAPI.DiffBookDepth().Symbol(strings.ToLower(s)).Execute()
+			if err != nil {
+				return fmt.Errorf("[adapter][exchange][binance][listenDepth] failed to execute diff depth streams: %w", err)
+			}
+
+			handler.On("message", func(dbd models.DiffBookDepthResponse) {
+				b.supervisor.RecordMessage(id)
+				err := b.processDiffDepth(book, dbd)
+				if err != nil {
+					logrus.
+						WithError(err).
+						WithField("symbol", book.symbol).
+						Error("[adapter][exchange][binance][listenDepth][diffDepthHandler]")
+				}
+			})
+		}
+	default:
+		return fmt.Errorf("[adapter][exchange][binance][listenDepth] unknown depth mode: %s", b.depthMode)
 	}
 
 	return nil
 }
 
-func (b *binance) ListenMarketDataInPartition(pairs []string, maxPairsPerConn int) {
-	id := 1
-	for start := 0; start < len(pairs); start += maxPairsPerConn {
-		end := min(start+maxPairsPerConn, len(pairs))
+// depthStreams lists the depth streams listened for a pair.
+func (b *binance) depthStreams(pair string) []string {
+	switch b.depthMode {
+	case DepthModePartial:
+		return []string{fmt.Sprintf("%s@depth%d", strings.ToLower(pair), b.depthLevels)}
+	case DepthModeDiff:
+		return []string{strings.ToLower(pair) + "@depth"}
+	default:
+		return nil
+	}
+}
+
+func (b *binance) ListenMarketDataInPartition(ctx context.Context, pairs []string, maxPairsPerConn int) {
+	b.pairsMu.Lock()
+	defer b.pairsMu.Unlock()
 
-		shard := pairs[start:end]
+	context.AfterFunc(ctx, b.cancel)
 
-		go b.ListenMarketData(id, shard)
+	if maxPairsPerConn > 0 {
+		b.maxPairsPerConn = maxPairsPerConn
+	}
+
+	b.startShards(pairs)
+}
+
+// startShards spreads pairs over new shards. The caller must hold b.pairsMu.
+func (b *binance) startShards(pairs []string) {
+	id := max(b.supervisor.NextShardId(), 1)
+	for start := 0; start < len(pairs); start += b.maxPairsPerConn {
+		end := min(start+b.maxPairsPerConn, len(pairs))
+
+		b.supervisor.Start(b.ctx, id, pairs[start:end], b.ListenMarketData)
 		id++
 	}
 }
+
+// Unsubscribe stops listening to a pair, on its live connection if any.
+func (b *binance) Unsubscribe(pair string) error {
+	_, ok := b.supervisor.ShardOf(pair)
+	if !ok {
+		return fmt.Errorf("[adapter][exchange][binance][Unsubscribe] pair not listened: %s", pair)
+	}
+
+	b.RemovePairs([]string{pair})
+
+	return nil
+}
+
+// Close stops every shard, closing their connections, and waits for them
+// until ctx is done.
+func (b *binance) Close(ctx context.Context) error {
+	b.cancel()
+
+	err := b.supervisor.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("[adapter][exchange][binance][Close][supervisor.Wait] %w", err)
+	}
+
+	return nil
+}
+
+func (b *binance) Status() []entity.ShardStatus {
+	return b.supervisor.Status(0)
+}
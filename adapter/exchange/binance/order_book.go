@@ -0,0 +1,366 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"sort"
+	"sync"
+	"time"
+
+	restModels "github.com/binance/binance-connector-go/clients/spot/src/restapi/models"
+	"github.com/binance/binance-connector-go/clients/spot/src/websocketstreams/models"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DepthModeNone    = ""
+	DepthModePartial = "partial"
+	DepthModeDiff    = "diff"
+
+	depthSnapshotLimit = 1000
+	depthMaxPending    = 1000
+)
+
+var errDepthGap = errors.New("depth update gap")
+
+// depthBook is a local order book kept in sync with the diff depth stream,
+// following https://developers.binance.com/docs/binance-spot-api-docs/web-socket-streams#how-to-manage-a-local-order-book-correctly
+type depthBook struct {
+	symbol string
+	levels int
+
+	lastUpdateId int64
+	hasSnapshot  bool
+	synced       bool
+	fetching     bool
+
+	bids map[string]entity.OrderBookLevel
+	asks map[string]entity.OrderBookLevel
+
+	pending []models.DiffBookDepthResponse
+
+	mu sync.Mutex
+}
+
+func newDepthBook(symbol string, levels int) *depthBook {
+	return &depthBook{
+		symbol: symbol,
+		levels: levels,
+		bids:   map[string]entity.OrderBookLevel{},
+		asks:   map[string]entity.OrderBookLevel{},
+	}
+}
+
+func (d *depthBook) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lastUpdateId = 0
+	d.hasSnapshot = false
+	d.synced = false
+	d.fetching = false
+	d.bids = map[string]entity.OrderBookLevel{}
+	d.asks = map[string]entity.OrderBookLevel{}
+	d.pending = nil
+}
+
+// requestSnapshot reports whether the caller should fetch a new snapshot and
+// marks the fetch as in flight.
+func (d *depthBook) requestSnapshot() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.hasSnapshot || d.fetching {
+		return false
+	}
+
+	d.fetching = true
+
+	return true
+}
+
+func (d *depthBook) applySnapshot(snapshot restModels.DepthResponse) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.fetching = false
+
+	if snapshot.LastUpdateId == nil {
+		return fmt.Errorf("[adapter][exchange][binance][depthBook][applySnapshot] missing lastUpdateId")
+	}
+
+	bids := map[string]entity.OrderBookLevel{}
+	asks := map[string]entity.OrderBookLevel{}
+
+	err := applyDepthLevels(bids, snapshot.Bids)
+	if err != nil {
+		return fmt.Errorf("[adapter][exchange][binance][depthBook][applySnapshot] bids: %w", err)
+	}
+
+	err = applyDepthLevels(asks, snapshot.Asks)
+	if err != nil {
+		return fmt.Errorf("[adapter][exchange][binance][depthBook][applySnapshot] asks: %w", err)
+	}
+
+	d.bids = bids
+	d.asks = asks
+	d.lastUpdateId = *snapshot.LastUpdateId
+	d.hasSnapshot = true
+	d.synced = false
+
+	pending := d.pending
+	d.pending = nil
+
+	for _, diff := range pending {
+		_, err := d.apply(diff)
+		if err != nil {
+			return fmt.Errorf("[adapter][exchange][binance][depthBook][applySnapshot][apply] %w", err)
+		}
+	}
+
+	return nil
+}
+
+// applyDiff applies a diff depth event, buffering it while no snapshot is
+// loaded. It returns errDepthGap when the event sequence is broken and the
+// book must be resynced from a fresh snapshot.
+func (d *depthBook) applyDiff(diff models.DiffBookDepthResponse) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.hasSnapshot {
+		d.pending = append(d.pending, diff)
+		if len(d.pending) > depthMaxPending {
+			d.pending = d.pending[len(d.pending)-depthMaxPending:]
+		}
+
+		return false, nil
+	}
+
+	return d.apply(diff)
+}
+
+func (d *depthBook) apply(diff models.DiffBookDepthResponse) (bool, error) {
+	if diff.U == nil || diff.Smallu == nil {
+		return false, fmt.Errorf("[adapter][exchange][binance][depthBook][apply] missing update ids")
+	}
+
+	firstUpdateId := *diff.U
+	finalUpdateId := *diff.Smallu
+
+	if finalUpdateId <= d.lastUpdateId {
+		return false, nil
+	}
+
+	if !d.synced && (firstUpdateId > d.lastUpdateId+1 || finalUpdateId < d.lastUpdateId+1) {
+		return false, fmt.Errorf("%w: snapshot %d, first event %d-%d", errDepthGap, d.lastUpdateId, firstUpdateId, finalUpdateId)
+	}
+
+	if d.synced && firstUpdateId != d.lastUpdateId+1 {
+		return false, fmt.Errorf("%w: expected %d, got %d", errDepthGap, d.lastUpdateId+1, firstUpdateId)
+	}
+
+	err := applyDepthLevels(d.bids, diff.B)
+	if err != nil {
+		return false, fmt.Errorf("[adapter][exchange][binance][depthBook][apply] bids: %w", err)
+	}
+
+	err = applyDepthLevels(d.asks, diff.A)
+	if err != nil {
+		return false, fmt.Errorf("[adapter][exchange][binance][depthBook][apply] asks: %w", err)
+	}
+
+	d.lastUpdateId = finalUpdateId
+	d.synced = true
+
+	return true, nil
+}
+
+func (d *depthBook) orderBook() entity.OrderBook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bids := make([]entity.OrderBookLevel, 0, len(d.bids))
+	for _, level := range d.bids {
+		bids = append(bids, level)
+	}
+
+	asks := make([]entity.OrderBookLevel, 0, len(d.asks))
+	for _, level := range d.asks {
+		asks = append(asks, level)
+	}
+
+	sort.Slice(bids, func(a, b int) bool {
+		return bids[a].Price.GreaterThan(bids[b].Price)
+	})
+	sort.Slice(asks, func(a, b int) bool {
+		return asks[a].Price.LessThan(asks[b].Price)
+	})
+
+	if d.levels > 0 {
+		bids = bids[:min(d.levels, len(bids))]
+		asks = asks[:min(d.levels, len(asks))]
+	}
+
+	return entity.OrderBook{
+		Epoch:    time.Now().Unix(),
+		Symbol:   d.symbol,
+		Exchange: "binance",
+		Bids:     bids,
+		Asks:     asks,
+		Sequence: d.lastUpdateId,
+	}
+}
+
+func applyDepthLevels(book map[string]entity.OrderBookLevel, levels [][]string) error {
+	for _, level := range levels {
+		if len(level) < 2 {
+			return fmt.Errorf("invalid level [raw: %v]", level)
+		}
+
+		price, err := decimal.NewFromString(level[0])
+		if err != nil {
+			return fmt.Errorf("invalid price [raw: %v]: %w", level, err)
+		}
+
+		size, err := decimal.NewFromString(level[1])
+		if err != nil {
+			return fmt.Errorf("invalid qty [raw: %v]: %w", level, err)
+		}
+
+		key := price.String()
+
+		if size.IsZero() {
+			delete(book, key)
+			continue
+		}
+
+		book[key] = entity.OrderBookLevel{
+			Price: price,
+			Size:  size,
+		}
+	}
+
+	return nil
+}
+
+func convertDepthLevels(levels [][]string) ([]entity.OrderBookLevel, error) {
+	book := map[string]entity.OrderBookLevel{}
+
+	err := applyDepthLevels(book, levels)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]entity.OrderBookLevel, 0, len(book))
+	for _, level := range book {
+		res = append(res, level)
+	}
+
+	return res, nil
+}
+
+func (b *binance) processPartialDepth(symbol string, data models.PartialBookDepthResponse) error {
+	bids, err := convertDepthLevels(data.Bids)
+	if err != nil {
+		return fmt.Errorf("[adapter][exchange][binance][processPartialDepth] bids: %w", err)
+	}
+
+	asks, err := convertDepthLevels(data.Asks)
+	if err != nil {
+		return fmt.Errorf("[adapter][exchange][binance][processPartialDepth] asks: %w", err)
+	}
+
+	sort.Slice(bids, func(a, b int) bool {
+		return bids[a].Price.GreaterThan(bids[b].Price)
+	})
+	sort.Slice(asks, func(a, b int) bool {
+		return asks[a].Price.LessThan(asks[b].Price)
+	})
+
+	ob := entity.OrderBook{
+		Epoch:    time.Now().Unix(),
+		Symbol:   symbol,
+		Exchange: "binance",
+		Bids:     bids,
+		Asks:     asks,
+	}
+
+	if data.LastUpdateId != nil {
+		ob.Sequence = *data.LastUpdateId
+	}
+
+	b.broadcastOrderBook(ob)
+
+	return nil
+}
+
+func (b *binance) processDiffDepth(book *depthBook, data models.DiffBookDepthResponse) error {
+	applied, err := book.applyDiff(data)
+	if errors.Is(err, errDepthGap) {
+		logrus.
+			WithError(err).
+			WithField("symbol", book.symbol).
+			Warn("[adapter][exchange][binance][processDiffDepth] resyncing order book")
+
+		book.reset()
+		book.applyDiff(data)
+	} else if err != nil {
+		return fmt.Errorf("[adapter][exchange][binance][processDiffDepth][applyDiff] %w", err)
+	}
+
+	if applied {
+		b.broadcastOrderBook(book.orderBook())
+	}
+
+	if book.requestSnapshot() {
+		go b.syncDepthSnapshot(book)
+	}
+
+	return nil
+}
+
+func (b *binance) syncDepthSnapshot(book *depthBook) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	snapshot, err := b.fetchDepthSnapshot(ctx, book.symbol)
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("symbol", book.symbol).
+			Error("[adapter][exchange][binance][syncDepthSnapshot][fetchDepthSnapshot]")
+
+		book.reset()
+		return
+	}
+
+	err = book.applySnapshot(snapshot)
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("symbol", book.symbol).
+			Warn("[adapter][exchange][binance][syncDepthSnapshot][applySnapshot] resyncing order book")
+
+		book.reset()
+		return
+	}
+
+	logrus.
+		WithField("symbol", book.symbol).
+		Info("[adapter][exchange][binance][syncDepthSnapshot] order book synced")
+
+	b.broadcastOrderBook(book.orderBook())
+}
+
+func (b *binance) getDepthSnapshot(ctx context.Context, symbol string) (restModels.DepthResponse, error) {
+	res, err := b.client.RestApi.MarketAPI.Depth(ctx).Symbol(symbol).Limit(depthSnapshotLimit).Execute()
+	if err != nil {
+		return restModels.DepthResponse{}, fmt.Errorf("[adapter][exchange][binance][getDepthSnapshot][MarketAPI.Depth] %w", err)
+	}
+
+	return res.Data, nil
+}
@@ -0,0 +1,176 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"michaelyusak/go-market-ingestor.git/bus"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"testing"
+	"time"
+
+	restModels "github.com/binance/binance-connector-go/clients/spot/src/restapi/models"
+	"github.com/binance/binance-connector-go/clients/spot/src/websocketstreams/models"
+	"github.com/shopspring/decimal"
+)
+
+func diffEvent(first, final int64, bids, asks [][]string) models.DiffBookDepthResponse {
+	return models.DiffBookDepthResponse{
+		U:      &first,
+		Smallu: &final,
+		B:      bids,
+		A:      asks,
+	}
+}
+
+func depthSnapshot(lastUpdateId int64, bids, asks [][]string) restModels.DepthResponse {
+	return restModels.DepthResponse{
+		LastUpdateId: &lastUpdateId,
+		Bids:         bids,
+		Asks:         asks,
+	}
+}
+
+func TestDepthBookAppliesBufferedDiffsAfterSnapshot(t *testing.T) {
+	book := newDepthBook("BTCUSDT", 0)
+
+	// older than the snapshot, dropped
+	applied, err := book.applyDiff(diffEvent(90, 100, [][]string{{"1", "9"}}, nil))
+	if err != nil || applied {
+		t.Fatalf("applyDiff before snapshot = %v, %v, want buffered", applied, err)
+	}
+
+	// straddles the snapshot, applied
+	applied, err = book.applyDiff(diffEvent(101, 110, [][]string{{"10", "2"}}, [][]string{{"11", "0"}}))
+	if err != nil || applied {
+		t.Fatalf("applyDiff before snapshot = %v, %v, want buffered", applied, err)
+	}
+
+	err = book.applySnapshot(depthSnapshot(105,
+		[][]string{{"10", "1"}, {"9", "1"}},
+		[][]string{{"11", "1"}, {"12", "1"}},
+	))
+	if err != nil {
+		t.Fatalf("applySnapshot: %v", err)
+	}
+
+	ob := book.orderBook()
+
+	if ob.Sequence != 110 {
+		t.Errorf("sequence = %d, want 110", ob.Sequence)
+	}
+
+	if len(ob.Bids) != 2 || !ob.Bids[0].Size.Equal(mustDecimal(t, "2")) {
+		t.Errorf("bids = %+v, want best bid 10 with size 2", ob.Bids)
+	}
+
+	if len(ob.Asks) != 1 || !ob.Asks[0].Price.Equal(mustDecimal(t, "12")) {
+		t.Errorf("asks = %+v, want ask 11 removed", ob.Asks)
+	}
+}
+
+func TestDepthBookDetectsGaps(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []models.DiffBookDepthResponse
+	}{
+		{
+			name:   "first event after the snapshot",
+			events: []models.DiffBookDepthResponse{diffEvent(120, 130, nil, nil)},
+		},
+		{
+			name: "missing event once synced",
+			events: []models.DiffBookDepthResponse{
+				diffEvent(101, 110, nil, nil),
+				diffEvent(112, 120, nil, nil),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := newDepthBook("BTCUSDT", 0)
+
+			err := book.applySnapshot(depthSnapshot(105, nil, nil))
+			if err != nil {
+				t.Fatalf("applySnapshot: %v", err)
+			}
+
+			for _, event := range tt.events {
+				_, err = book.applyDiff(event)
+			}
+
+			if !errors.Is(err, errDepthGap) {
+				t.Fatalf("applyDiff error = %v, want errDepthGap", err)
+			}
+		})
+	}
+}
+
+func TestProcessDiffDepthResyncsAfterGap(t *testing.T) {
+	topic := bus.NewTopic[entity.OrderBook](bus.New(), "order_book")
+
+	sub, err := topic.Subscribe(bus.SubscriberOpt{Name: "test", BufferSize: 10})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	snapshots := make(chan int64, 2)
+	snapshots <- 105
+	snapshots <- 205
+
+	b := &binance{
+		orderBookTopic: topic,
+		fetchDepthSnapshot: func(ctx context.Context, symbol string) (restModels.DepthResponse, error) {
+			return depthSnapshot(<-snapshots, [][]string{{"10", "1"}}, [][]string{{"11", "1"}}), nil
+		},
+	}
+
+	book := newDepthBook("BTCUSDT", 0)
+
+	err = b.processDiffDepth(book, diffEvent(101, 110, nil, nil))
+	if err != nil {
+		t.Fatalf("processDiffDepth: %v", err)
+	}
+
+	if ob := waitOrderBook(t, sub.C()); ob.Sequence != 110 {
+		t.Fatalf("first sync sequence = %d, want 110", ob.Sequence)
+	}
+
+	// 111 to 199 are lost, the book resyncs from a new snapshot
+	err = b.processDiffDepth(book, diffEvent(200, 210, [][]string{{"10", "3"}}, nil))
+	if err != nil {
+		t.Fatalf("processDiffDepth: %v", err)
+	}
+
+	ob := waitOrderBook(t, sub.C())
+	if ob.Sequence != 210 {
+		t.Fatalf("resync sequence = %d, want 210", ob.Sequence)
+	}
+
+	if len(ob.Bids) != 1 || !ob.Bids[0].Size.Equal(mustDecimal(t, "3")) {
+		t.Errorf("bids = %+v, want the buffered event applied on the new snapshot", ob.Bids)
+	}
+}
+
+func waitOrderBook(t *testing.T, ch <-chan entity.OrderBook) entity.OrderBook {
+	t.Helper()
+
+	select {
+	case ob := <-ch:
+		return ob
+	case <-time.After(time.Second):
+		t.Fatal("no order book published")
+		return entity.OrderBook{}
+	}
+}
+
+func mustDecimal(t *testing.T, s string) decimal.Decimal {
+	t.Helper()
+
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		t.Fatalf("decimal.NewFromString(%q): %v", s, err)
+	}
+
+	return d
+}
@@ -0,0 +1,84 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"michaelyusak/go-market-ingestor.git/entity"
+
+	restModels "github.com/binance/binance-connector-go/clients/spot/src/restapi/models"
+	"github.com/shopspring/decimal"
+)
+
+const symbolStatusTrading = "TRADING"
+
+// FetchPairMeta lists every symbol from exchangeInfo. Prices and volumes
+// precisions are the tick and step sizes, the minimum trade is the minimum
+// notional in the quote asset.
+func (b *binance) FetchPairMeta(ctx context.Context) ([]entity.PairMeta, error) {
+	res, err := b.client.RestApi.GeneralAPI.ExchangeInfo(ctx).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("[adapter][exchange][binance][FetchPairMeta][GeneralAPI.ExchangeInfo] %w", err)
+	}
+
+	now := time.Now().Unix()
+	metas := make([]entity.PairMeta, 0, len(res.Data.Symbols))
+
+	for _, symbol := range res.Data.Symbols {
+		meta := entity.PairMeta{
+			Exchange:       "binance",
+			ID:             symbol.GetSymbol(),
+			BaseCurrency:   strings.ToLower(symbol.GetQuoteAsset()),
+			TradedCurrency: strings.ToLower(symbol.GetBaseAsset()),
+			UpdatedAt:      now,
+		}
+
+		applySymbolFilters(&meta, symbol.Filters)
+
+		// BREAK and HALT stop a market outright, the auction and pre/post
+		// trading phases are transient
+		switch symbol.GetStatus() {
+		case symbolStatusTrading:
+		case "BREAK", "HALT", "END_OF_DAY":
+			meta.IsSuspended = true
+		default:
+			meta.IsMaintenance = true
+		}
+
+		metas = append(metas, meta)
+	}
+
+	return metas, nil
+}
+
+func applySymbolFilters(meta *entity.PairMeta, filters []restModels.SymbolFilters) {
+	for _, filter := range filters {
+		switch {
+		case filter.PriceFilter != nil:
+			meta.PricePrecision = parseFilterValue(filter.PriceFilter.TickSize)
+		case filter.LotSizeFilter != nil:
+			meta.VolumePrecision = parseFilterValue(filter.LotSizeFilter.StepSize)
+		case filter.NotionalFilter != nil:
+			meta.MinBaseTrade = parseFilterValue(filter.NotionalFilter.MinNotional)
+		case filter.MinNotionalFilter != nil:
+			if meta.MinBaseTrade.IsZero() {
+				meta.MinBaseTrade = parseFilterValue(filter.MinNotionalFilter.MinNotional)
+			}
+		}
+	}
+}
+
+func parseFilterValue(v *string) decimal.Decimal {
+	if v == nil {
+		return decimal.Zero
+	}
+
+	d, err := decimal.NewFromString(*v)
+	if err != nil {
+		return decimal.Zero
+	}
+
+	return d
+}
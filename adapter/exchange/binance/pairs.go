@@ -0,0 +1,126 @@
+package binance
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AddPairs starts listening to pairs at runtime. Pairs fill up the running
+// shards first, subscribing on their live connections, and spill over into
+// new shards.
+func (b *binance) AddPairs(pairs []string) {
+	b.pairsMu.Lock()
+	defer b.pairsMu.Unlock()
+
+	placed, overflow := b.supervisor.Place(pairs, b.maxPairsPerConn)
+
+	for id := range placed {
+		sess, ok := b.sessionById(id)
+		if !ok {
+			// picked up once the shard connects
+			continue
+		}
+
+		b.syncSession(sess)
+	}
+
+	b.startShards(overflow)
+}
+
+// RemovePairs stops listening to pairs at runtime, unsubscribing their streams
+// on the live connections of their shards.
+func (b *binance) RemovePairs(pairs []string) {
+	b.pairsMu.Lock()
+	defer b.pairsMu.Unlock()
+
+	removed := b.supervisor.RemovePairs(pairs)
+
+	for id := range removed {
+		sess, ok := b.sessionById(id)
+		if !ok {
+			continue
+		}
+
+		b.syncSession(sess)
+	}
+}
+
+// syncSession brings the streams of a live session in line with the pairs
+// assigned to its shard. A failed request leaves the session as it is: the
+// connection is broken and the next attempt of the shard subscribes afresh.
+// It holds the session's syncMu for the whole run, as the connector does not
+// guard its stream map against concurrent subscription changes.
+func (b *binance) syncSession(sess *session) {
+	sess.syncMu.Lock()
+	defer sess.syncMu.Unlock()
+
+	want := b.supervisor.Pairs(sess.id)
+	have := sess.listPairs()
+
+	hasFold := func(pairs []string, pair string) bool {
+		return slices.ContainsFunc(pairs, func(p string) bool {
+			return strings.EqualFold(p, pair)
+		})
+	}
+
+	for _, pair := range have {
+		if hasFold(want, pair) {
+			continue
+		}
+
+		streams := append([]string{aggTradeStream(pair)}, b.depthStreams(pair)...)
+
+		err := sess.ws.Unsubscribe(streams)
+		if err != nil {
+			logrus.
+				WithField("id", sess.id).
+				WithField("pair", pair).
+				WithError(err).
+				Warn("[adapter][exchange][binance][syncSession] failed to unsubscribe pair")
+			return
+		}
+
+		have = slices.DeleteFunc(have, func(p string) bool { return p == pair })
+		sess.setPairs(slices.Clone(have))
+
+		logrus.
+			WithField("id", sess.id).
+			WithField("pair", pair).
+			Info("[adapter][exchange][binance][syncSession] unsubscribed pair")
+	}
+
+	for _, pair := range want {
+		if hasFold(have, pair) {
+			continue
+		}
+
+		err := b.subscribeAggTrade(sess, pair)
+		if err == nil {
+			err = b.listenDepth(sess.ws, sess.id, []string{pair})
+		}
+		if err != nil {
+			logrus.
+				WithField("id", sess.id).
+				WithField("pair", pair).
+				WithError(err).
+				Warn("[adapter][exchange][binance][syncSession] failed to subscribe pair")
+			return
+		}
+
+		have = append(have, pair)
+		sess.setPairs(slices.Clone(have))
+
+		logrus.
+			WithField("id", sess.id).
+			WithField("pair", pair).
+			Info("[adapter][exchange][binance][syncSession] subscribed pair")
+	}
+}
+
+func (b *binance) Listens(pair string) bool {
+	_, ok := b.supervisor.ShardOf(pair)
+
+	return ok
+}
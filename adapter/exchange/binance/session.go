@@ -0,0 +1,142 @@
+package binance
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	streams "github.com/binance/binance-connector-go/clients/spot/src/websocketstreams"
+	"github.com/binance/binance-connector-go/clients/spot/src/websocketstreams/models"
+	"github.com/sirupsen/logrus"
+)
+
+// session is the live connection of one shard.
+type session struct {
+	id    int
+	ws    *streams.WebsocketStreamsClient
+	pairs []string
+
+	mu sync.Mutex
+
+	// syncMu serializes subscription changes on ws. The connector keeps its
+	// stream map (GlobalStreamConnectionMap) unguarded, so every Subscribe or
+	// Unsubscribe on a live session must hold it.
+	syncMu sync.Mutex
+}
+
+func (s *session) hasPair(pair string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.ContainsFunc(s.pairs, func(p string) bool {
+		return strings.EqualFold(p, pair)
+	})
+}
+
+func (s *session) listPairs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.pairs)
+}
+
+func (s *session) setPairs(pairs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pairs = pairs
+}
+
+func aggTradeStream(pair string) string {
+	return strings.ToLower(pair) + "@aggTrade"
+}
+
+func (b *binance) subscribeAggTrade(sess *session, pair string) error {
+	handler, err := sess.ws.WebSocketStreamsAPI.AggTrade().Symbol(strings.ToLower(pair)).Execute()
+	if err != nil {
+		return fmt.Errorf("[adapter][exchange][binance][subscribeAggTrade] failed to execute streams: %w", err)
+	}
+
+	handler.On("message", func(atr models.AggTradeResponse) {
+		b.supervisor.RecordMessage(sess.id)
+		logrus.WithField("symbol", *atr.S).Debug("[adapter][exchange][binance][ListenMarketData] new aggTrade message")
+
+		err := b.processAggTrade(atr)
+		if err != nil {
+			logrus.
+				WithError(err).
+				WithField("symbol", *atr.S).
+				Error("[adapter][exchange][binance][ListenMarketData][messageHandler]")
+		}
+	})
+
+	return nil
+}
+
+func (b *binance) setSession(id int, sess *session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sessions[id] = sess
+}
+
+func (b *binance) removeSession(id int, sess *session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.sessions[id] == sess {
+		delete(b.sessions, id)
+	}
+}
+
+func (b *binance) sessionById(id int) (*session, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sess, ok := b.sessions[id]
+	return sess, ok
+}
+
+// sessionOf finds the live session listening to pair.
+func (b *binance) sessionOf(pair string) (*session, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sess := range b.sessions {
+		if sess.hasPair(pair) {
+			return sess, true
+		}
+	}
+
+	return nil, false
+}
+
+// Resubscribe renews the aggTrade subscription of a pair on its live
+// connection, for pairs that silently stopped receiving.
+func (b *binance) Resubscribe(pair string) error {
+	sess, ok := b.sessionOf(pair)
+	if !ok {
+		return fmt.Errorf("[adapter][exchange][binance][Resubscribe] no live session for pair %s", pair)
+	}
+
+	sess.syncMu.Lock()
+	defer sess.syncMu.Unlock()
+
+	// the pair may have been removed while waiting for the lock
+	if !sess.hasPair(pair) {
+		return fmt.Errorf("[adapter][exchange][binance][Resubscribe] pair %s no longer listened", pair)
+	}
+
+	err := sess.ws.Unsubscribe([]string{aggTradeStream(pair)})
+	if err != nil {
+		return fmt.Errorf("[adapter][exchange][binance][Resubscribe][ws.Unsubscribe] %w", err)
+	}
+
+	err = b.subscribeAggTrade(sess, pair)
+	if err != nil {
+		return fmt.Errorf("[adapter][exchange][binance][Resubscribe][subscribeAggTrade] %w", err)
+	}
+
+	return nil
+}
@@ -10,11 +10,22 @@ import (
 )
 
 func (b *binance) processAggTrade(data models.AggTradeResponse) error {
+	ta, err := convertAggTrade(data)
+	if err != nil {
+		return err
+	}
+
+	b.broadcastTradeActivity(ta)
+
+	return nil
+}
+
+func convertAggTrade(data models.AggTradeResponse) (entity.TradeActivityV2, error) {
 	var ta entity.TradeActivityV2
 
 	if data.S == nil || data.P == nil || data.Q == nil || data.M == nil || data.E == nil {
 		b, _ := json.Marshal(data)
-		return fmt.Errorf("[adapter][exchange][binance][processAggTrade] invalid aggTrade payload [raw: %s]", string(b))
+		return ta, fmt.Errorf("[adapter][exchange][binance][convertAggTrade] invalid aggTrade payload [raw: %s]", string(b))
 	}
 
 	ta.Epoch = *data.E / 1000
@@ -31,13 +42,13 @@ func (b *binance) processAggTrade(data models.AggTradeResponse) error {
 	// price
 	price, err := decimal.NewFromString(*data.P)
 	if err != nil {
-		return fmt.Errorf("[adapter][exchange][binance][processAggTrade] invalid price: %w", err)
+		return ta, fmt.Errorf("[adapter][exchange][binance][convertAggTrade] invalid price: %w", err)
 	}
 
 	// base volume
 	baseQty, err := decimal.NewFromString(*data.Q)
 	if err != nil {
-		return fmt.Errorf("[adapter][exchange][binance][processAggTrade] invalid qty: %w", err)
+		return ta, fmt.Errorf("[adapter][exchange][binance][convertAggTrade] invalid qty: %w", err)
 	}
 
 	ta.Price = price
@@ -47,7 +58,5 @@ func (b *binance) processAggTrade(data models.AggTradeResponse) error {
 	// deterministic key
 	ta.Key = fmt.Sprintf("%s-%d-%d", ta.Symbol, *data.A, *data.T)
 
-	b.broadcastTradeActivity(ta)
-
-	return nil
+	return ta, nil
 }
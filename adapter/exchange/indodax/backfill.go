@@ -0,0 +1,200 @@
+package indodax
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	indodaxEntity "michaelyusak/go-market-ingestor.git/entity/indodax"
+)
+
+// Backfill fetches recent trades for each pair from the public REST API and
+// publishes those in [from, to) to the backfill topic. It returns how many
+// trades were published.
+//
+// The API only serves the latest trades, so a range starting before the
+// oldest of them cannot be fully backfilled. The other pairs are still
+// backfilled and ErrBackfillOutOfRange is returned at the end.
+func (i *indodax) Backfill(ctx context.Context, pairs []string, from, to time.Time) (int, error) {
+	total := 0
+
+	var outOfRange error
+
+	for _, pair := range pairs {
+		n, err := i.backfillPair(ctx, pair, from, to)
+		total += n
+
+		if errors.Is(err, exchange.ErrBackfillOutOfRange) {
+			outOfRange = errors.Join(outOfRange, fmt.Errorf("pair %s: %w", pair, err))
+			continue
+		}
+
+		if err != nil {
+			return total, fmt.Errorf("[adapters][exchanges][indodax][Backfill][backfillPair] pair %s: %w", pair, err)
+		}
+	}
+
+	if outOfRange != nil {
+		return total, fmt.Errorf("[adapters][exchanges][indodax][Backfill] %w", outOfRange)
+	}
+
+	return total, nil
+}
+
+func (i *indodax) backfillPair(ctx context.Context, pair string, from, to time.Time) (int, error) {
+	var trades []indodaxEntity.IndodaxTrade
+
+	res, err := i.client.R().
+		SetContext(ctx).
+		SetResult(&trades).
+		Get(fmt.Sprintf("%s/api/trades/%s", i.baseUrl, pair))
+	if err != nil {
+		return 0, fmt.Errorf("[adapters][exchanges][indodax][backfillPair][client.Get] %w", err)
+	}
+
+	if res.StatusCode() != http.StatusOK {
+		return 0, fmt.Errorf("[adapters][exchanges][indodax][backfillPair] unexpected status %d [raw: %s]", res.StatusCode(), res.String())
+	}
+
+	seen := map[string]int{}
+	published := 0
+	oldest := int64(0)
+
+	// the API returns newest first, publish oldest first
+	for idx := len(trades) - 1; idx >= 0; idx-- {
+		tradeActivityData, err := convertRestTrade(pair, trades[idx])
+		if err != nil {
+			logrus.
+				WithError(err).
+				WithField("pair", pair).
+				Warn("[adapters][exchanges][indodax][backfillPair][convertRestTrade]")
+			continue
+		}
+
+		ts := int64(tradeActivityData[1].(float64))
+		if oldest == 0 {
+			oldest = ts
+		}
+
+		if ts < from.Unix() || ts >= to.Unix() {
+			continue
+		}
+
+		seq := int64(tradeActivityData[2].(float64))
+		key := tradeKey(pair, seq)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		i.tradeBackfillTopic.Publish(i.convertTradeActivity(key, tradeActivityData))
+
+		seen[key] = 1
+		published++
+	}
+
+	// trades between from and the oldest served one may exist but are gone
+	// from the API
+	if oldest > from.Unix() {
+		return published, fmt.Errorf("%w: oldest trade served at %d, asked from %d", exchange.ErrBackfillOutOfRange, oldest, from.Unix())
+	}
+
+	return published, nil
+}
+
+// convertRestTrade shapes a REST trade like a websocket trade activity row,
+// [pair, timestamp, sequence, side, price, base volume, quote volume], so both
+// go through convertTradeActivity.
+func convertRestTrade(pair string, trade indodaxEntity.IndodaxTrade) ([]any, error) {
+	ts, err := strconv.ParseInt(trade.Date, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date [raw: %+v]: %w", trade, err)
+	}
+
+	seq, err := strconv.ParseInt(trade.Tid, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tid [raw: %+v]: %w", trade, err)
+	}
+
+	price, err := decimal.NewFromString(trade.Price)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price [raw: %+v]: %w", trade, err)
+	}
+
+	amount, err := decimal.NewFromString(trade.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount [raw: %+v]: %w", trade, err)
+	}
+
+	priceFl, _ := price.Float64()
+
+	return []any{
+		pair,
+		float64(ts),
+		float64(seq),
+		trade.Type,
+		priceFl,
+		amount.String(),
+		price.Mul(amount).String(),
+	}, nil
+}
+
+func (i *indodax) markDisconnected(id int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.disconnectedAt[id]; !ok {
+		i.disconnectedAt[id] = time.Now()
+	}
+}
+
+func (i *indodax) takeDisconnected(id int) (time.Time, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	since, ok := i.disconnectedAt[id]
+	delete(i.disconnectedAt, id)
+
+	return since, ok
+}
+
+func (i *indodax) backfillAfterReconnect(id int, pairs []string) {
+	since, ok := i.takeDisconnected(id)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(i.ctx, time.Duration(len(pairs))*(i.tradeTimeout+time.Second))
+	defer cancel()
+
+	// trades shortly before the disconnect may have been in flight
+	n, err := i.Backfill(ctx, pairs, since.Add(-time.Minute), time.Now())
+	if errors.Is(err, exchange.ErrBackfillOutOfRange) {
+		logrus.
+			WithError(err).
+			WithField("id", id).
+			WithField("trades", n).
+			Warn("[adapter][exchanges][indodax][backfillAfterReconnect][Backfill] disconnected longer than the API serves, trades may be missing")
+		return
+	}
+
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("id", id).
+			Error("[adapter][exchanges][indodax][backfillAfterReconnect][Backfill]")
+		return
+	}
+
+	logrus.
+		WithField("id", id).
+		WithField("trades", n).
+		WithField("since", since.String()).
+		Info("[adapter][exchanges][indodax][backfillAfterReconnect] backfill done")
+}
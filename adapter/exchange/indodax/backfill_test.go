@@ -0,0 +1,237 @@
+package indodax
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"michaelyusak/go-market-ingestor.git/bus"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	indodaxEntity "michaelyusak/go-market-ingestor.git/entity/indodax"
+)
+
+func newTestClient(t *testing.T, baseUrl string) (*indodax, *bus.Subscriber[entity.TradeActivityV2], *bus.Subscriber[entity.TradeActivityV2]) {
+	t.Helper()
+
+	b := bus.New()
+	tradeActivityTopic := bus.NewTopic[entity.TradeActivityV2](b, "trade_activity")
+	tradeBackfillTopic := bus.NewTopic[entity.TradeActivityV2](b, "trade_backfill")
+
+	liveSub, err := tradeActivityTopic.Subscribe(bus.SubscriberOpt{Name: "test", BufferSize: 100})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	backfillSub, err := tradeBackfillTopic.Subscribe(bus.SubscriberOpt{Name: "test", BufferSize: 100})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	i := NewClient(
+		baseUrl, "ws", "localhost", "/ws", "", "", "",
+		time.Second,
+		tradeActivityTopic,
+		tradeBackfillTopic,
+		bus.NewTopic[entity.OrderBook](b, "order_book"),
+		exchange.SupervisorOpt{},
+	)
+
+	return i, liveSub, backfillSub
+}
+
+func drain(ch <-chan entity.TradeActivityV2) []entity.TradeActivityV2 {
+	trades := []entity.TradeActivityV2{}
+
+	for {
+		select {
+		case trade := <-ch:
+			trades = append(trades, trade)
+		default:
+			return trades
+		}
+	}
+}
+
+func TestConvertRestTrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		trade   indodaxEntity.IndodaxTrade
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			trade: indodaxEntity.IndodaxTrade{Date: "1700000000", Price: "650000000", Amount: "0.002", Tid: "42", Type: "buy"},
+		},
+		{
+			name:    "invalid date",
+			trade:   indodaxEntity.IndodaxTrade{Date: "yesterday", Price: "650000000", Amount: "0.002", Tid: "42", Type: "buy"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid tid",
+			trade:   indodaxEntity.IndodaxTrade{Date: "1700000000", Price: "650000000", Amount: "0.002", Tid: "", Type: "buy"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid price",
+			trade:   indodaxEntity.IndodaxTrade{Date: "1700000000", Price: "n/a", Amount: "0.002", Tid: "42", Type: "buy"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid amount",
+			trade:   indodaxEntity.IndodaxTrade{Date: "1700000000", Price: "650000000", Amount: "", Tid: "42", Type: "buy"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, err := convertRestTrade("btcidr", tt.trade)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("convertRestTrade = %v, want error", row)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("convertRestTrade: %v", err)
+			}
+
+			i := &indodax{}
+			trade := i.convertTradeActivity(tradeKey("btcidr", 42), row)
+
+			if trade.Epoch != 1700000000 || trade.Side != entity.TradeSideBuy || trade.Symbol != "btcidr" {
+				t.Errorf("trade = %+v", trade)
+			}
+
+			if trade.QuoteVolume.String() != "1300000" {
+				t.Errorf("quote volume = %s, want 1300000", trade.QuoteVolume.String())
+			}
+		})
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	// newest first, as the API returns them
+	trades := []indodaxEntity.IndodaxTrade{
+		{Date: "1700000200", Price: "650000000", Amount: "0.1", Tid: "104", Type: "sell"},
+		{Date: "1700000100", Price: "650000000", Amount: "0.1", Tid: "103", Type: "buy"},
+		{Date: "1700000100", Price: "650000000", Amount: "0.1", Tid: "103", Type: "buy"},
+		{Date: "1700000050", Price: "649000000", Amount: "0.2", Tid: "102", Type: "sell"},
+		{Date: "bad", Price: "649000000", Amount: "0.2", Tid: "101", Type: "sell"},
+		{Date: "1699999000", Price: "648000000", Amount: "0.3", Tid: "100", Type: "buy"},
+	}
+
+	var path string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(trades)
+	}))
+	defer srv.Close()
+
+	i, _, backfillSub := newTestClient(t, srv.URL)
+
+	n, err := i.Backfill(context.Background(), []string{"btcidr"}, time.Unix(1700000000, 0), time.Unix(1700000200, 0))
+	if err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+
+	if path != "/api/trades/btcidr" {
+		t.Errorf("path = %s, want /api/trades/btcidr", path)
+	}
+
+	published := drain(backfillSub.C())
+
+	wantKeys := []string{"btcidr-102", "btcidr-103"}
+
+	if n != len(wantKeys) || len(published) != len(wantKeys) {
+		t.Fatalf("published %d (%d received), want %d", n, len(published), len(wantKeys))
+	}
+
+	for idx, trade := range published {
+		if trade.Key != wantKeys[idx] {
+			t.Errorf("trade %d key = %s, want %s", idx, trade.Key, wantKeys[idx])
+		}
+	}
+}
+
+func TestBackfillUnexpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	i, _, _ := newTestClient(t, srv.URL)
+
+	_, err := i.Backfill(context.Background(), []string{"btcidr"}, time.Unix(0, 0), time.Now())
+	if err == nil {
+		t.Fatal("Backfill succeeded, want error")
+	}
+}
+
+func TestBackfillOutOfRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]indodaxEntity.IndodaxTrade{
+			{Date: "1700000200", Price: "650000000", Amount: "0.1", Tid: "104", Type: "sell"},
+			{Date: "1700000100", Price: "650000000", Amount: "0.1", Tid: "103", Type: "buy"},
+		})
+	}))
+	defer srv.Close()
+
+	i, _, backfillSub := newTestClient(t, srv.URL)
+
+	// the API serves nothing older than 1700000100
+	n, err := i.Backfill(context.Background(), []string{"btcidr", "ethidr"}, time.Unix(1700000000, 0), time.Unix(1700000300, 0))
+	if !errors.Is(err, exchange.ErrBackfillOutOfRange) {
+		t.Fatalf("Backfill error = %v, want ErrBackfillOutOfRange", err)
+	}
+
+	// both pairs are still backfilled as far as the API goes
+	if published := drain(backfillSub.C()); n != 4 || len(published) != 4 {
+		t.Errorf("published %d (%d received), want 4", n, len(published))
+	}
+}
+
+func TestBackfillKeysMatchWebsocket(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]indodaxEntity.IndodaxTrade{
+			{Date: "1700000101", Price: "650000000", Amount: "0.1", Tid: "103", Type: "buy"},
+		})
+	}))
+	defer srv.Close()
+
+	i, liveSub, backfillSub := newTestClient(t, srv.URL)
+
+	// the websocket reported the same trade a second earlier than REST
+	err := i.processTradeActivity(json.RawMessage(`[["btcidr", 1700000100, 103, "buy", 650000000, "0.1", "65000000"]]`))
+	if err != nil {
+		t.Fatalf("processTradeActivity: %v", err)
+	}
+
+	_, err = i.Backfill(context.Background(), []string{"btcidr"}, time.Unix(1700000101, 0), time.Unix(1700000200, 0))
+	if err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+
+	live := drain(liveSub.C())
+	backfilled := drain(backfillSub.C())
+
+	if len(live) != 1 || len(backfilled) != 1 {
+		t.Fatalf("got %d live and %d backfilled trades, want 1 each", len(live), len(backfilled))
+	}
+
+	if live[0].Key != backfilled[0].Key {
+		t.Errorf("websocket key %s, REST key %s, want equal", live[0].Key, backfilled[0].Key)
+	}
+}
@@ -1,10 +1,14 @@
 package indodax
 
 import (
+	"context"
 	"sync"
 	"time"
 
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"michaelyusak/go-market-ingestor.git/bus"
 	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/metrics"
 
 	"github.com/go-resty/resty/v2"
 )
@@ -21,7 +25,22 @@ type indodax struct {
 	client       *resty.Client
 	tradeTimeout time.Duration
 
-	tradeActivityCh []chan entity.TradeActivityV2
+	tradeActivityTopic *bus.Topic[entity.TradeActivityV2]
+	tradeBackfillTopic *bus.Topic[entity.TradeActivityV2]
+	orderBookTopic     *bus.Topic[entity.OrderBook]
+
+	supervisor     *exchange.Supervisor
+	sessions       map[int]*session
+	disconnectedAt map[int]time.Time
+
+	// maxPairsPerConn sizes the shards; pairsMu serializes changes to the
+	// listened pairs.
+	maxPairsPerConn int
+	pairsMu         sync.Mutex
+
+	// ctx bounds every shard, cancel stops them
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	mu sync.Mutex
 }
@@ -35,8 +54,13 @@ func NewClient(
 	orderBookChanPrefix,
 	tradeActivityChanPrefix string,
 	tradeTimeout time.Duration,
-	tradeActivityCh []chan entity.TradeActivityV2,
+	tradeActivityTopic *bus.Topic[entity.TradeActivityV2],
+	tradeBackfillTopic *bus.Topic[entity.TradeActivityV2],
+	orderBookTopic *bus.Topic[entity.OrderBook],
+	supervisorOpt exchange.SupervisorOpt,
 ) *indodax {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &indodax{
 		baseUrl:                 baseUrl,
 		wsScheme:                wsScheme,
@@ -46,20 +70,37 @@ func NewClient(
 		orderBookChanPrefix:     orderBookChanPrefix,
 		tradeActivityChanPrefix: tradeActivityChanPrefix,
 
-		client:       resty.New(),
+		client:       resty.New().SetTimeout(tradeTimeout),
 		tradeTimeout: tradeTimeout,
 
-		tradeActivityCh: tradeActivityCh,
+		tradeActivityTopic: tradeActivityTopic,
+		tradeBackfillTopic: tradeBackfillTopic,
+		orderBookTopic:     orderBookTopic,
+
+		supervisor:     exchange.NewSupervisor("indodax", supervisorOpt),
+		sessions:       map[int]*session{},
+		disconnectedAt: map[int]time.Time{},
+
+		maxPairsPerConn: 10,
+
+		ctx:    ctx,
+		cancel: cancel,
 	}
 }
 
+func (i *indodax) Supervisor() *exchange.Supervisor {
+	return i.supervisor
+}
+
 func (i *indodax) broadcastTradeActivity(ta entity.TradeActivityV2) {
-	for _, ch := range i.tradeActivityCh {
-		select {
-		case ch <- ta:
-			// sent successfully
-		default:
-			// channel not ready, skip or log
-		}
+	metrics.TradesReceived.WithLabelValues(ta.Exchange, ta.Symbol).Inc()
+
+	dropped := i.tradeActivityTopic.Publish(ta)
+	if dropped > 0 {
+		metrics.BroadcastDropped.WithLabelValues(ta.Exchange).Add(float64(dropped))
 	}
 }
+
+func (i *indodax) broadcastOrderBook(ob entity.OrderBook) {
+	i.orderBookTopic.Publish(ob)
+}
@@ -2,15 +2,19 @@ package indodax
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 
+	"michaelyusak/go-market-ingestor.git/entity"
 	indodaxEntity "michaelyusak/go-market-ingestor.git/entity/indodax"
 )
 
@@ -20,20 +24,42 @@ type marketDataListenerEvent struct {
 	Info  string
 }
 
-func (i *indodax) ListenMarketData(id int, pairs []string) error {
+func (e marketDataListenerEvent) err() error {
+	if e.Error == nil {
+		return errors.New(e.Info)
+	}
+
+	return fmt.Errorf("%s: %w", e.Info, e.Error)
+}
+
+// ListenMarketData runs one session and blocks until it fails. Restarting is
+// left to the supervisor.
+func (i *indodax) ListenMarketData(ctx context.Context, id int, pairs []string) error {
 	u := url.URL{Scheme: i.wsScheme, Host: i.wsHost, Path: i.wsPath}
 
-	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
 	if err != nil {
-		return fmt.Errorf("[adapters][exchanges][indodax][ListenMarketData][websocket.DefaultDialer.Dial] Error: %w", err)
+		return fmt.Errorf("[adapters][exchanges][indodax][ListenMarketData][websocket.DefaultDialer.DialContext] Error: %w", err)
 	}
 	defer c.Close()
 
+	// never closed: the readers may still report after the session returned
 	quit := make(chan marketDataListenerEvent, 10)
-	defer close(quit)
+	report := func(e marketDataListenerEvent) {
+		select {
+		case quit <- e:
+		default:
+		}
+	}
 
 	clientId := time.Now().Unix() + int64(id)
 
+	sess := &session{
+		conn:     c,
+		clientId: clientId,
+		pairs:    slices.Clone(pairs),
+	}
+
 	authMsg := indodaxEntity.IndodaxWsMessage{
 		Params: indodaxEntity.IndodaxWsMessageParams{
 			Token: i.publicWsToken,
@@ -41,69 +67,78 @@ func (i *indodax) ListenMarketData(id int, pairs []string) error {
 		Id: clientId,
 	}
 
-	authenticated := make(chan bool)
+	authenticated := make(chan bool, 1)
 
 	go func() {
 		messageType, data, err := c.ReadMessage()
 		if err != nil {
-			quit <- marketDataListenerEvent{
+			report(marketDataListenerEvent{
 				Close: false,
 				Error: err,
 				Info:  "[adapters][exchanges][indodax][ListenMarketData][Auth][c.ReadMessage()]",
-			}
+			})
 			return
 		}
 
 		if messageType != websocket.TextMessage {
-			quit <- marketDataListenerEvent{
+			report(marketDataListenerEvent{
 				Close: false,
 				Error: err,
 				Info:  "[adapters][exchanges][indodax][ListenMarketData][Auth][messageTypeNotTextMessage)]",
-			}
+			})
 			return
 		}
 
 		var msg indodaxEntity.IndodaxWsResponse
 		err = json.Unmarshal(data, &msg)
 		if err != nil {
-			quit <- marketDataListenerEvent{
+			report(marketDataListenerEvent{
 				Close: false,
 				Error: err,
 				Info:  fmt.Sprintf("[adapters][exchanges][indodax][ListenMarketData][Auth][json.Unmarshal] [raw: %s]", string(data)),
-			}
+			})
 			return
 		}
 
 		if msg.Result.Client == "" {
-			quit <- marketDataListenerEvent{
+			report(marketDataListenerEvent{
 				Close: false,
 				Error: err,
 				Info:  fmt.Sprintf("[adapters][exchanges][indodax][ListenMarketData][Auth][json.Unmarshal] [raw: %s]", string(data)),
-			}
+			})
 			return
 		}
 
 		authenticated <- true
 	}()
 
-	c.WriteJSON(authMsg)
+	sess.writeJSON(authMsg)
 
-	<-authenticated
-	close(authenticated)
+	select {
+	case <-authenticated:
+	case e := <-quit:
+		i.markDisconnected(id)
+		return e.err()
+	case <-ctx.Done():
+		sess.close()
+		return nil
+	}
 
 	go func() {
 	loop:
 		for {
 			messageType, data, err := c.ReadMessage()
 			if err != nil {
-				quit <- marketDataListenerEvent{
+				report(marketDataListenerEvent{
 					Close: false,
 					Error: err,
 					Info:  "[adapters][exchanges][indodax][ListenMarketData][c.ReadMessage()]",
-				}
+				})
 				break loop
 			}
 
+			i.supervisor.RecordMessage(id)
+
 			if messageType != websocket.TextMessage {
 				continue
 			}
@@ -115,11 +150,11 @@ func (i *indodax) ListenMarketData(id int, pairs []string) error {
 				var msg indodaxEntity.IndodaxWsResponse
 				err := dec.Decode(&msg)
 				if err != nil {
-					quit <- marketDataListenerEvent{
+					report(marketDataListenerEvent{
 						Close: false,
 						Error: err,
 						Info:  fmt.Sprintf("[adapters][exchanges][indodax][ListenMarketData][dec.Decode] Unmarshal Response [raw: %s]", string(data)),
-					}
+					})
 					continue loop
 				}
 
@@ -127,42 +162,54 @@ func (i *indodax) ListenMarketData(id int, pairs []string) error {
 					logrus.WithField("channel", msg.Result.Channel).Debug("[adapter][exchange][indodax][ListenMarketData] new trade activity message")
 					err = i.processTradeActivity(msg.Result.Data.Data)
 					if err != nil {
-						quit <- marketDataListenerEvent{
+						report(marketDataListenerEvent{
 							Close: false,
 							Error: err,
 							Info:  "[adapters][exchanges][indodax][ListenMarketData][processTradeActivity]",
-						}
+						})
+					}
+					continue loop
+				}
+
+				if i.orderBookChanPrefix != "" && strings.HasPrefix(msg.Result.Channel, i.orderBookChanPrefix) {
+					logrus.WithField("channel", msg.Result.Channel).Debug("[adapter][exchange][indodax][ListenMarketData] new order book message")
+					err = i.processOrderBook(msg.Result.Data.Data, msg.Result.Data.Offset)
+					if err != nil {
+						report(marketDataListenerEvent{
+							Close: false,
+							Error: err,
+							Info:  "[adapters][exchanges][indodax][ListenMarketData][processOrderBook]",
+						})
 					}
 					continue loop
 				}
 			}
 		}
 
-		quit <- marketDataListenerEvent{
+		report(marketDataListenerEvent{
 			Close: false,
 			Error: err,
 			Info:  "[adapters][exchanges][indodax][ListenMarketData][LoopBroken]",
-		}
+		})
 	}()
 
-	mapIdx := 1
-
-	for _, pair := range pairs {
-		tradeActivityChanName := i.tradeActivityChanPrefix + pair
-		subscribeTradeActivityMsg := indodaxEntity.IndodaxWsMessage{
-			Method: 1,
-			Params: indodaxEntity.IndodaxWsMessageParams{
-				Channel: tradeActivityChanName,
-			},
-			Id: clientId,
+	for idx, pair := range pairs {
+		err := i.subscribePair(sess, pair)
+		if err != nil {
+			i.markDisconnected(id)
+			return fmt.Errorf("[adapters][exchanges][indodax][ListenMarketData][subscribePair] %w", err)
 		}
-		c.WriteJSON(subscribeTradeActivityMsg)
+
 		logrus.WithFields(logrus.Fields{
 			"id": id,
-		}).Debugf("[adapter][exchanges][indodax][ListenMarketData] %v/%v subscribed to %s trade activity channel", mapIdx, len(pairs), pair)
+		}).Debugf("[adapter][exchanges][indodax][ListenMarketData] %v/%v subscribed to %s channels", idx+1, len(pairs), pair)
 
-		mapIdx++
-		time.Sleep(500 * time.Millisecond)
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-ctx.Done():
+			sess.close()
+			return nil
+		}
 	}
 
 	logrus.
@@ -171,30 +218,94 @@ func (i *indodax) ListenMarketData(id int, pairs []string) error {
 		}).
 		Info("[adapter][exchanges][indodax][ListenMarketData] market data websocket fully initiated")
 
-	e := <-quit
+	i.setSession(id, sess)
+	defer i.removeSession(id, sess)
+
+	i.supervisor.MarkConnected(id)
+
+	// pairs may have been added or removed while the session was starting
+	i.syncSession(id, sess)
+
+	go i.backfillAfterReconnect(id, pairs)
+
+	var e marketDataListenerEvent
+
+	select {
+	case e = <-quit:
+	case <-ctx.Done():
+		logrus.
+			WithFields(logrus.Fields{
+				"id": id,
+			}).
+			Info("[adapter][exchanges][indodax][ListenMarketData] closing market data websocket")
+		sess.close()
+		return nil
+	}
 
 	if e.Close {
-		return fmt.Errorf("[%s] %s CLOSING Indodax market data listener. Error: %w", time.Now().String(), e.Info, e.Error)
+		logrus.
+			WithFields(logrus.Fields{
+				"id": id,
+			}).
+			WithError(e.Error).
+			Errorf("CLOSING Indodax market data listener. %s", e.Info)
+		return nil
 	}
 
-	logrus.
-		WithFields(logrus.Fields{
-			"id": id,
-		}).
-		WithError(e.Error).
-		Errorf("RESTARTING Indodax market data listener. %s", e.Info)
+	i.markDisconnected(id)
 
-	return i.ListenMarketData(id, pairs)
+	return e.err()
 }
 
-func (i *indodax) ListenMarketDataInPartition(pairs []string, maxPairsPerConn int) {
-	id := 1
-	for start := 0; start < len(pairs); start += maxPairsPerConn {
-		end := min(start+maxPairsPerConn, len(pairs))
+func (i *indodax) ListenMarketDataInPartition(ctx context.Context, pairs []string, maxPairsPerConn int) {
+	i.pairsMu.Lock()
+	defer i.pairsMu.Unlock()
+
+	context.AfterFunc(ctx, i.cancel)
+
+	if maxPairsPerConn > 0 {
+		i.maxPairsPerConn = maxPairsPerConn
+	}
+
+	i.startShards(pairs)
+}
 
-		shard := pairs[start:end]
+// startShards spreads pairs over new shards. The caller must hold i.pairsMu.
+func (i *indodax) startShards(pairs []string) {
+	id := max(i.supervisor.NextShardId(), 1)
+	for start := 0; start < len(pairs); start += i.maxPairsPerConn {
+		end := min(start+i.maxPairsPerConn, len(pairs))
 
-		go i.ListenMarketData(id, shard)
+		i.supervisor.Start(i.ctx, id, pairs[start:end], i.ListenMarketData)
 		id++
 	}
 }
+
+// Unsubscribe stops listening to a pair, on its live connection if any.
+func (i *indodax) Unsubscribe(pair string) error {
+	_, ok := i.supervisor.ShardOf(pair)
+	if !ok {
+		return fmt.Errorf("[adapters][exchanges][indodax][Unsubscribe] pair not listened: %s", pair)
+	}
+
+	i.RemovePairs([]string{pair})
+
+	return nil
+}
+
+// Close stops every shard, closing their connections, and waits for them
+// until ctx is done.
+func (i *indodax) Close(ctx context.Context) error {
+	i.cancel()
+
+	err := i.supervisor.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("[adapters][exchanges][indodax][Close][supervisor.Wait] %w", err)
+	}
+
+	return nil
+}
+
+func (i *indodax) Status() []entity.ShardStatus {
+	return i.supervisor.Status(0)
+}
@@ -0,0 +1,103 @@
+package indodax
+
+import (
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	indodaxEntity "michaelyusak/go-market-ingestor.git/entity/indodax"
+)
+
+func (i *indodax) processOrderBook(data json.RawMessage, offset int64) error {
+	var indodaxOrderBook indodaxEntity.IndodaxOrderBook
+
+	err := json.Unmarshal(data, &indodaxOrderBook)
+	if err != nil {
+		return fmt.Errorf("[adapters][exchanges][indodax][processOrderBook][json.Unmarshal] Unmarshal order book: %w", err)
+	}
+
+	orderBook, err := i.convertOrderBook(indodaxOrderBook, offset)
+	if err != nil {
+		return fmt.Errorf("[adapters][exchanges][indodax][processOrderBook][convertOrderBook] %w", err)
+	}
+
+	i.broadcastOrderBook(orderBook)
+
+	return nil
+}
+
+func (i *indodax) convertOrderBook(ob indodaxEntity.IndodaxOrderBook, offset int64) (entity.OrderBook, error) {
+	bids, err := convertBookLevels(ob.Pair, ob.Bid)
+	if err != nil {
+		return entity.OrderBook{}, fmt.Errorf("[adapters][exchanges][indodax][convertOrderBook] bid: %w", err)
+	}
+
+	asks, err := convertBookLevels(ob.Pair, ob.Ask)
+	if err != nil {
+		return entity.OrderBook{}, fmt.Errorf("[adapters][exchanges][indodax][convertOrderBook] ask: %w", err)
+	}
+
+	sort.Slice(bids, func(a, b int) bool {
+		return bids[a].Price.GreaterThan(bids[b].Price)
+	})
+	sort.Slice(asks, func(a, b int) bool {
+		return asks[a].Price.LessThan(asks[b].Price)
+	})
+
+	return entity.OrderBook{
+		Epoch:    time.Now().Unix(),
+		Symbol:   ob.Pair,
+		Exchange: "indodax",
+		Bids:     bids,
+		Asks:     asks,
+		Sequence: offset,
+	}, nil
+}
+
+// convertBookLevels reads levels shaped like
+// {"price": "...", "btc_volume": "...", "idr_volume": "..."} where the base
+// volume key is the one whose currency prefixes the pair.
+func convertBookLevels(pair string, levels []indodaxEntity.IndodaxRawBookLevel) ([]entity.OrderBookLevel, error) {
+	res := make([]entity.OrderBookLevel, 0, len(levels))
+
+	for _, level := range levels {
+		price, err := decimal.NewFromString(level["price"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid price [raw: %v]: %w", level, err)
+		}
+
+		var size decimal.Decimal
+		found := false
+
+		for key, value := range level {
+			currency, ok := strings.CutSuffix(key, "_volume")
+			if !ok || !strings.HasPrefix(pair, currency) {
+				continue
+			}
+
+			size, err = decimal.NewFromString(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid volume [raw: %v]: %w", level, err)
+			}
+
+			found = true
+			break
+		}
+
+		if !found {
+			return nil, fmt.Errorf("base volume not found [raw: %v]", level)
+		}
+
+		res = append(res, entity.OrderBookLevel{
+			Price: price,
+			Size:  size,
+		})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,48 @@
+package indodax
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"michaelyusak/go-market-ingestor.git/entity"
+	indodaxEntity "michaelyusak/go-market-ingestor.git/entity/indodax"
+)
+
+// FetchPairMeta lists every pair from the public pairs endpoint.
+func (i *indodax) FetchPairMeta(ctx context.Context) ([]entity.PairMeta, error) {
+	var pairs []indodaxEntity.IndodaxPair
+
+	res, err := i.client.R().
+		SetContext(ctx).
+		SetResult(&pairs).
+		Get(fmt.Sprintf("%s/api/pairs", i.baseUrl))
+	if err != nil {
+		return nil, fmt.Errorf("[adapters][exchanges][indodax][FetchPairMeta][client.Get] %w", err)
+	}
+
+	if res.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("[adapters][exchanges][indodax][FetchPairMeta] unexpected status %d [raw: %s]", res.StatusCode(), res.String())
+	}
+
+	now := time.Now().Unix()
+	metas := make([]entity.PairMeta, 0, len(pairs))
+
+	for _, pair := range pairs {
+		metas = append(metas, entity.PairMeta{
+			Exchange:        "indodax",
+			ID:              pair.Id,
+			BaseCurrency:    pair.BaseCurrency,
+			TradedCurrency:  pair.TradedCurrency,
+			PricePrecision:  pair.PricePrecision,
+			VolumePrecision: pair.VolumePrecision,
+			MinBaseTrade:    pair.TradeMinBaseCurrency,
+			IsSuspended:     pair.IsMarketSuspended != 0,
+			IsMaintenance:   pair.IsMaintenance != 0,
+			UpdatedAt:       now,
+		})
+	}
+
+	return metas, nil
+}
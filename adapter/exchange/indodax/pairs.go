@@ -0,0 +1,112 @@
+package indodax
+
+import (
+	"slices"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AddPairs starts listening to pairs at runtime. Pairs fill up the running
+// shards first, subscribing on their live connections, and spill over into
+// new shards.
+func (i *indodax) AddPairs(pairs []string) {
+	i.pairsMu.Lock()
+	defer i.pairsMu.Unlock()
+
+	placed, overflow := i.supervisor.Place(pairs, i.maxPairsPerConn)
+
+	for id := range placed {
+		sess, ok := i.sessionById(id)
+		if !ok {
+			// picked up once the shard connects
+			continue
+		}
+
+		i.syncSession(id, sess)
+	}
+
+	i.startShards(overflow)
+}
+
+// RemovePairs stops listening to pairs at runtime, unsubscribing them on the
+// live connections of their shards.
+func (i *indodax) RemovePairs(pairs []string) {
+	i.pairsMu.Lock()
+	defer i.pairsMu.Unlock()
+
+	removed := i.supervisor.RemovePairs(pairs)
+
+	for id := range removed {
+		sess, ok := i.sessionById(id)
+		if !ok {
+			continue
+		}
+
+		i.syncSession(id, sess)
+	}
+}
+
+// syncSession brings the subscriptions of a live session in line with the
+// pairs assigned to its shard. A failed write leaves the session as it is: the
+// connection is broken and the next attempt of the shard subscribes afresh.
+func (i *indodax) syncSession(id int, sess *session) {
+	sess.syncMu.Lock()
+	defer sess.syncMu.Unlock()
+
+	want := i.supervisor.Pairs(id)
+	have := sess.listPairs()
+
+	for _, pair := range have {
+		if slices.Contains(want, pair) {
+			continue
+		}
+
+		err := i.unsubscribePair(sess, pair)
+		if err != nil {
+			logrus.
+				WithField("id", id).
+				WithField("pair", pair).
+				WithError(err).
+				Warn("[adapter][exchanges][indodax][syncSession] failed to unsubscribe pair")
+			return
+		}
+
+		have = slices.DeleteFunc(have, func(p string) bool { return p == pair })
+		sess.setPairs(slices.Clone(have))
+
+		logrus.
+			WithField("id", id).
+			WithField("pair", pair).
+			Info("[adapter][exchanges][indodax][syncSession] unsubscribed pair")
+	}
+
+	for _, pair := range want {
+		if slices.Contains(have, pair) {
+			continue
+		}
+
+		err := i.subscribePair(sess, pair)
+		if err != nil {
+			logrus.
+				WithField("id", id).
+				WithField("pair", pair).
+				WithError(err).
+				Warn("[adapter][exchanges][indodax][syncSession] failed to subscribe pair")
+			return
+		}
+
+		have = append(have, pair)
+		sess.setPairs(slices.Clone(have))
+
+		logrus.
+			WithField("id", id).
+			WithField("pair", pair).
+			Info("[adapter][exchanges][indodax][syncSession] subscribed pair")
+	}
+}
+
+func (i *indodax) Listens(pair string) bool {
+	_, ok := i.supervisor.ShardOf(pair)
+
+	return ok
+}
@@ -0,0 +1,168 @@
+package indodax
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	indodaxEntity "michaelyusak/go-market-ingestor.git/entity/indodax"
+)
+
+const (
+	methodSubscribe   = 1
+	methodUnsubscribe = 2
+)
+
+// session is the live connection of one shard. Subscriptions may be written
+// from other goroutines than the listener, so writes are serialized.
+type session struct {
+	conn     *websocket.Conn
+	clientId int64
+	pairs    []string
+
+	mu     sync.Mutex
+	syncMu sync.Mutex
+}
+
+func (s *session) hasPair(pair string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Contains(s.pairs, pair)
+}
+
+func (s *session) listPairs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.pairs)
+}
+
+func (s *session) setPairs(pairs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pairs = pairs
+}
+
+func (s *session) writeJSON(v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn.WriteJSON(v)
+}
+
+// close tells the exchange the session is going away. The connection itself
+// is closed by the listener.
+func (s *session) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+func (s *session) send(method int, channel string) error {
+	return s.writeJSON(indodaxEntity.IndodaxWsMessage{
+		Method: method,
+		Params: indodaxEntity.IndodaxWsMessageParams{
+			Channel: channel,
+		},
+		Id: s.clientId,
+	})
+}
+
+// channels lists the channels listened for a pair.
+func (i *indodax) channels(pair string) []string {
+	channels := []string{i.tradeActivityChanPrefix + pair}
+
+	if i.orderBookChanPrefix != "" {
+		channels = append(channels, i.orderBookChanPrefix+pair)
+	}
+
+	return channels
+}
+
+func (i *indodax) subscribePair(sess *session, pair string) error {
+	for _, channel := range i.channels(pair) {
+		err := sess.send(methodSubscribe, channel)
+		if err != nil {
+			return fmt.Errorf("[adapters][exchanges][indodax][subscribePair][session.send] channel %s: %w", channel, err)
+		}
+	}
+
+	return nil
+}
+
+func (i *indodax) unsubscribePair(sess *session, pair string) error {
+	for _, channel := range i.channels(pair) {
+		err := sess.send(methodUnsubscribe, channel)
+		if err != nil {
+			return fmt.Errorf("[adapters][exchanges][indodax][unsubscribePair][session.send] channel %s: %w", channel, err)
+		}
+	}
+
+	return nil
+}
+
+func (i *indodax) setSession(id int, sess *session) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.sessions[id] = sess
+}
+
+func (i *indodax) removeSession(id int, sess *session) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.sessions[id] == sess {
+		delete(i.sessions, id)
+	}
+}
+
+func (i *indodax) sessionById(id int) (*session, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	sess, ok := i.sessions[id]
+	return sess, ok
+}
+
+// sessionOf finds the live session listening to pair.
+func (i *indodax) sessionOf(pair string) (*session, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, sess := range i.sessions {
+		if sess.hasPair(pair) {
+			return sess, true
+		}
+	}
+
+	return nil, false
+}
+
+// Resubscribe drops and renews the subscriptions of a pair on its live
+// connection, for pairs that silently stopped receiving.
+func (i *indodax) Resubscribe(pair string) error {
+	sess, ok := i.sessionOf(pair)
+	if !ok {
+		return fmt.Errorf("[adapters][exchanges][indodax][Resubscribe] no live session for pair %s", pair)
+	}
+
+	err := i.unsubscribePair(sess, pair)
+	if err != nil {
+		return fmt.Errorf("[adapters][exchanges][indodax][Resubscribe][unsubscribePair] %w", err)
+	}
+
+	err = i.subscribePair(sess, pair)
+	if err != nil {
+		return fmt.Errorf("[adapters][exchanges][indodax][Resubscribe][subscribePair] %w", err)
+	}
+
+	return nil
+}
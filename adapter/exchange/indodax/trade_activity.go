@@ -19,9 +19,9 @@ func (i *indodax) processTradeActivity(data json.RawMessage) error {
 	seen := map[string]int{}
 
 	for _, ta := range indodaxTradeActivityData {
-		ts := int64(ta[1].(float64))
+		symbol := ta[0].(string)
 		seq := int64(ta[2].(float64))
-		key := fmt.Sprintf("%d-%d", ts, seq)
+		key := tradeKey(symbol, seq)
 		if _, ok := seen[key]; ok {
 			continue
 		}
@@ -34,6 +34,13 @@ func (i *indodax) processTradeActivity(data json.RawMessage) error {
 	return nil
 }
 
+// tradeKey identifies a trade by its pair and exchange trade id, the sequence
+// of a websocket row and the tid of a REST trade, so a trade seen on both
+// paths gets the same key.
+func tradeKey(pair string, tradeId int64) string {
+	return fmt.Sprintf("%s-%d", pair, tradeId)
+}
+
 func (i *indodax) convertTradeActivity(key string, tradeActivityData []any) entity.TradeActivityV2 {
 	priceDecimal := decimal.NewFromFloat(tradeActivityData[4].(float64))
 	baseVolumeDecimal, _ := decimal.NewFromString(tradeActivityData[5].(string))
@@ -1,6 +1,49 @@
 package exchange
 
+import (
+	"context"
+	"errors"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"time"
+)
+
+// ErrBackfillOutOfRange is returned by a Backfiller whose exchange no longer
+// serves trades as old as the range asked for.
+var ErrBackfillOutOfRange = errors.New("backfill range older than the exchange serves")
+
+// Exchage streams the market data of pairs over sharded connections. Shards
+// run until the ctx given to ListenMarketDataInPartition is done or Close is
+// called.
 type Exchage interface {
-	ListenMarketData(id int, pairs []string) error
-	ListenMarketDataInPartition(pairs []string, maxPairsPerConn int)
+	ListenMarketData(ctx context.Context, id int, pairs []string) error
+	ListenMarketDataInPartition(ctx context.Context, pairs []string, maxPairsPerConn int)
+	// Unsubscribe stops listening to a pair, on its live connection if any.
+	Unsubscribe(pair string) error
+	// Close stops every shard and waits for them until ctx is done.
+	Close(ctx context.Context) error
+	Status() []entity.ShardStatus
+}
+
+// Backfiller republishes trades executed in [from, to) to the backfill topic.
+// When part of the range is too old it still publishes what it can and
+// returns an error wrapping ErrBackfillOutOfRange.
+type Backfiller interface {
+	Backfill(ctx context.Context, pairs []string, from, to time.Time) (int, error)
+}
+
+type PairMetaFetcher interface {
+	FetchPairMeta(ctx context.Context) ([]entity.PairMeta, error)
+}
+
+// Resubscriber renews the subscription of a pair on its live connection.
+type Resubscriber interface {
+	Resubscribe(pair string) error
+}
+
+// PairManager changes the listened pairs of a running adapter.
+type PairManager interface {
+	AddPairs(pairs []string)
+	RemovePairs(pairs []string)
+	// Listens reports whether a shard still running listens to pair
+	Listens(pair string) bool
 }
@@ -0,0 +1,462 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type SupervisorOpt struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64 // fraction of the backoff added or removed at random
+	// MaxAttempts consecutive failures open the circuit; the shard is then
+	// retried once per CircuitCooldown, or given up on when it is 0.
+	MaxAttempts     int
+	CircuitCooldown time.Duration
+	// a session connected for at least StableAfter resets the attempts
+	StableAfter time.Duration
+}
+
+const rateWindow = 10 * time.Second
+
+type shardState struct {
+	status       entity.ShardStatus
+	connectedAt  time.Time
+	registeredAt time.Time
+	// gaveUp is set once the shard stopped retrying; its pairs are kept for
+	// the status but no longer count as listened
+	gaveUp bool
+
+	lastMessageAt time.Time
+	windowStart   time.Time
+	windowCount   int
+	rate          float64
+}
+
+// roll closes the rate window once it is old enough.
+func (s *shardState) roll(now time.Time) {
+	elapsed := now.Sub(s.windowStart)
+	if elapsed < rateWindow {
+		return
+	}
+
+	s.rate = float64(s.windowCount) / elapsed.Seconds()
+	s.windowStart = now
+	s.windowCount = 0
+}
+
+// Supervisor keeps the market data shards of one exchange running, restarting
+// a shard with exponential backoff whenever its session ends with an error.
+type Supervisor struct {
+	exchange string
+	opt      SupervisorOpt
+
+	shards map[int]*shardState
+
+	wg sync.WaitGroup
+	mu sync.Mutex
+}
+
+func NewSupervisor(exchange string, opt SupervisorOpt) *Supervisor {
+	if opt.InitialBackoff <= 0 {
+		opt.InitialBackoff = time.Second
+	}
+
+	if opt.MaxBackoff < opt.InitialBackoff {
+		opt.MaxBackoff = max(time.Minute, opt.InitialBackoff)
+	}
+
+	if opt.Jitter < 0 || opt.Jitter > 1 {
+		opt.Jitter = 0.2
+	}
+
+	if opt.StableAfter <= 0 {
+		opt.StableAfter = time.Minute
+	}
+
+	return &Supervisor{
+		exchange: exchange,
+		opt:      opt,
+		shards:   map[int]*shardState{},
+	}
+}
+
+// Start registers the shard and supervises it in the background until ctx is
+// done or listen returns nil.
+func (s *Supervisor) Start(ctx context.Context, id int, pairs []string, listen func(ctx context.Context, id int, pairs []string) error) {
+	s.register(id, pairs)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.supervise(ctx, id, listen)
+	}()
+}
+
+// Wait blocks until every shard has stopped or ctx is done.
+func (s *Supervisor) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("[adapter][exchange][Supervisor][Wait] %s shards still running: %w", s.exchange, ctx.Err())
+	}
+}
+
+// supervise runs listen for a registered shard. listen should block for as
+// long as the session is alive and call MarkConnected once it is receiving
+// data. Every attempt is given the current pairs of the shard.
+func (s *Supervisor) supervise(ctx context.Context, id int, listen func(ctx context.Context, id int, pairs []string) error) {
+	for {
+		err := listen(ctx, id, s.Pairs(id))
+		if err == nil || ctx.Err() != nil {
+			s.setState(id, entity.ShardStateStopped, nil)
+			return
+		}
+
+		attempts := s.recordFailure(id, err)
+
+		if s.opt.MaxAttempts > 0 && attempts >= s.opt.MaxAttempts {
+			s.setState(id, entity.ShardStateFailed, err)
+
+			if s.opt.CircuitCooldown <= 0 {
+				s.giveUp(id)
+
+				logrus.
+					WithField("exchange", s.exchange).
+					WithField("id", id).
+					WithField("attempts", attempts).
+					WithError(err).
+					Error("[adapter][exchange][Supervisor][supervise] giving up on shard")
+				return
+			}
+
+			logrus.
+				WithField("exchange", s.exchange).
+				WithField("id", id).
+				WithField("attempts", attempts).
+				WithField("cooldown", s.opt.CircuitCooldown.String()).
+				WithError(err).
+				Error("[adapter][exchange][Supervisor][supervise] circuit open")
+
+			if !sleep(ctx, s.opt.CircuitCooldown) {
+				s.setState(id, entity.ShardStateStopped, nil)
+				return
+			}
+
+			s.setState(id, entity.ShardStateReconnecting, err)
+			continue
+		}
+
+		backoff := s.backoff(attempts)
+
+		logrus.
+			WithField("exchange", s.exchange).
+			WithField("id", id).
+			WithField("attempts", attempts).
+			WithField("backoff", backoff.String()).
+			WithError(err).
+			Warn("[adapter][exchange][Supervisor][supervise] reconnecting shard")
+
+		s.setState(id, entity.ShardStateReconnecting, err)
+
+		if !sleep(ctx, backoff) {
+			s.setState(id, entity.ShardStateStopped, nil)
+			return
+		}
+	}
+}
+
+// sleep waits for d and reports false when ctx was done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Supervisor) backoff(attempts int) time.Duration {
+	backoff := s.opt.InitialBackoff
+	for i := 1; i < attempts && backoff < s.opt.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, s.opt.MaxBackoff)
+
+	jitter := (rand.Float64()*2 - 1) * s.opt.Jitter * float64(backoff)
+
+	return backoff + time.Duration(jitter)
+}
+
+func (s *Supervisor) register(id int, pairs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	s.shards[id] = &shardState{
+		registeredAt: now,
+		windowStart:  now,
+		status: entity.ShardStatus{
+			Exchange:   s.exchange,
+			ShardId:    id,
+			Pairs:      slices.Clone(pairs),
+			State:      entity.ShardStateConnecting,
+			StateSince: now.Unix(),
+		},
+	}
+}
+
+// Pairs returns the pairs currently assigned to the shard.
+func (s *Supervisor) Pairs(id int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shard, ok := s.shards[id]
+	if !ok {
+		return nil
+	}
+
+	return slices.Clone(shard.status.Pairs)
+}
+
+// Place assigns pairs not yet listened to the running shards that have room
+// for them, up to maxPairsPerShard. It returns the pairs placed per shard and
+// the ones left over for new shards.
+func (s *Supervisor) Place(pairs []string, maxPairsPerShard int) (map[int][]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int, 0, len(s.shards))
+	for id, shard := range s.shards {
+		if shard.status.State == entity.ShardStateStopped || shard.status.State == entity.ShardStateFailed {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	placed := map[int][]string{}
+	overflow := []string{}
+
+	for _, pair := range pairs {
+		if s.shardOf(pair) >= 0 || containsFold(overflow, pair) {
+			continue
+		}
+
+		found := false
+		for _, id := range ids {
+			shard := s.shards[id]
+			if len(shard.status.Pairs) >= maxPairsPerShard {
+				continue
+			}
+
+			shard.status.Pairs = append(shard.status.Pairs, pair)
+			placed[id] = append(placed[id], pair)
+			found = true
+			break
+		}
+
+		if !found {
+			overflow = append(overflow, pair)
+		}
+	}
+
+	return placed, overflow
+}
+
+// RemovePairs takes pairs off the shards they are assigned to and returns the
+// pairs removed per shard.
+func (s *Supervisor) RemovePairs(pairs []string) map[int][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := map[int][]string{}
+
+	for _, pair := range pairs {
+		id := s.shardOf(pair)
+		if id < 0 {
+			continue
+		}
+
+		shard := s.shards[id]
+		shard.status.Pairs = slices.DeleteFunc(shard.status.Pairs, func(p string) bool {
+			return strings.EqualFold(p, pair)
+		})
+		removed[id] = append(removed[id], pair)
+	}
+
+	return removed
+}
+
+// NextShardId returns an id not used by any shard yet.
+func (s *Supervisor) NextShardId() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := 0
+	for id := range s.shards {
+		next = max(next, id+1)
+	}
+
+	return next
+}
+
+// ShardOf returns the id of the shard listening to pair.
+func (s *Supervisor) ShardOf(pair string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.shardOf(pair)
+
+	return id, id >= 0
+}
+
+// shardOf returns the id of the shard listening to pair, or -1. Shards
+// stopped or given up on listen to nothing, so adding their pairs again places
+// them on a live shard. The caller must hold s.mu.
+func (s *Supervisor) shardOf(pair string) int {
+	for id, shard := range s.shards {
+		if shard.status.State == entity.ShardStateStopped || shard.gaveUp {
+			continue
+		}
+
+		if containsFold(shard.status.Pairs, pair) {
+			return id
+		}
+	}
+
+	return -1
+}
+
+func containsFold(pairs []string, pair string) bool {
+	return slices.ContainsFunc(pairs, func(p string) bool {
+		return strings.EqualFold(p, pair)
+	})
+}
+
+// MarkConnected is called by a session once it is subscribed and receiving.
+func (s *Supervisor) MarkConnected(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shard, ok := s.shards[id]
+	if !ok {
+		return
+	}
+
+	shard.connectedAt = time.Now()
+	shard.status.State = entity.ShardStateConnected
+	shard.status.StateSince = shard.connectedAt.Unix()
+}
+
+// RecordMessage is called by a session for every message it receives.
+func (s *Supervisor) RecordMessage(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shard, ok := s.shards[id]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+
+	shard.roll(now)
+	shard.lastMessageAt = now
+	shard.windowCount++
+}
+
+func (s *Supervisor) recordFailure(id int, err error) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shard := s.shards[id]
+
+	if !shard.connectedAt.IsZero() && time.Since(shard.connectedAt) >= s.opt.StableAfter {
+		shard.status.Attempts = 0
+	}
+
+	shard.connectedAt = time.Time{}
+	shard.status.Attempts++
+	shard.status.LastError = err.Error()
+
+	return shard.status.Attempts
+}
+
+func (s *Supervisor) giveUp(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shards[id].gaveUp = true
+}
+
+func (s *Supervisor) setState(id int, state entity.ShardState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shard := s.shards[id]
+
+	if shard.status.State != state {
+		shard.status.StateSince = time.Now().Unix()
+	}
+	shard.status.State = state
+
+	if err != nil {
+		shard.status.LastError = err.Error()
+	}
+}
+
+// Status returns a snapshot of every shard, ordered by id. A running shard is
+// silent when nothing was received for silentThreshold, 0 disables the check.
+func (s *Supervisor) Status(silentThreshold time.Duration) []entity.ShardStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	statuses := make([]entity.ShardStatus, 0, len(s.shards))
+	for _, shard := range s.shards {
+		shard.roll(now)
+
+		status := shard.status
+		status.Pairs = slices.Clone(status.Pairs)
+		status.MessagesPerSecond = shard.rate
+
+		lastSeen := shard.registeredAt
+		if !shard.lastMessageAt.IsZero() {
+			status.LastMessageAt = shard.lastMessageAt.Unix()
+			lastSeen = shard.lastMessageAt
+		}
+
+		status.Silent = silentThreshold > 0 &&
+			status.State != entity.ShardStateStopped &&
+			now.Sub(lastSeen) > silentThreshold
+
+		statuses = append(statuses, status)
+	}
+
+	slices.SortFunc(statuses, func(a, b entity.ShardStatus) int {
+		return a.ShardId - b.ShardId
+	})
+
+	return statuses
+}
@@ -0,0 +1,251 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDialer stands in for an adapter session: every attempt fails with the
+// next error, or returns nil once they run out.
+type fakeDialer struct {
+	errs []error
+	// connectFor keeps a session connected before it fails
+	connectFor time.Duration
+
+	calls []time.Time
+	pairs [][]string
+
+	mu sync.Mutex
+}
+
+func (d *fakeDialer) listen(s *Supervisor) func(ctx context.Context, id int, pairs []string) error {
+	return func(ctx context.Context, id int, pairs []string) error {
+		d.mu.Lock()
+		d.calls = append(d.calls, time.Now())
+		d.pairs = append(d.pairs, pairs)
+		attempt := len(d.calls)
+		d.mu.Unlock()
+
+		if d.connectFor > 0 {
+			s.MarkConnected(id)
+			time.Sleep(d.connectFor)
+		}
+
+		if attempt > len(d.errs) {
+			return nil
+		}
+
+		return d.errs[attempt-1]
+	}
+}
+
+func (d *fakeDialer) attempts() []time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]time.Time(nil), d.calls...)
+}
+
+func shardStatus(t *testing.T, s *Supervisor, id int) entity.ShardStatus {
+	t.Helper()
+
+	for _, status := range s.Status(0) {
+		if status.ShardId == id {
+			return status
+		}
+	}
+
+	t.Fatalf("shard %d not found", id)
+	return entity.ShardStatus{}
+}
+
+func waitStopped(t *testing.T, s *Supervisor) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := s.Wait(ctx)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	s := NewSupervisor("test", SupervisorOpt{
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+	})
+	s.opt.Jitter = 0
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+
+	for i, w := range want {
+		if got := s.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+func TestSupervisorBackoffJitter(t *testing.T) {
+	s := NewSupervisor("test", SupervisorOpt{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Jitter:         0.5,
+	})
+
+	for range 1000 {
+		got := s.backoff(2)
+		if got < time.Second || got > 3*time.Second {
+			t.Fatalf("backoff(2) = %s, want within 50%% of 2s", got)
+		}
+	}
+}
+
+func TestSupervisorReconnects(t *testing.T) {
+	s := NewSupervisor("test", SupervisorOpt{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	dialer := &fakeDialer{errs: []error{errors.New("refused"), errors.New("reset")}}
+	s.Start(context.Background(), 0, []string{"btcidr"}, dialer.listen(s))
+
+	waitStopped(t, s)
+
+	if n := len(dialer.attempts()); n != 3 {
+		t.Fatalf("attempts = %d, want 3", n)
+	}
+
+	status := shardStatus(t, s, 0)
+	if status.State != entity.ShardStateStopped || status.Attempts != 2 || status.LastError != "reset" {
+		t.Errorf("status = %+v, want stopped after 2 failed attempts", status)
+	}
+}
+
+func TestSupervisorCircuitCooldown(t *testing.T) {
+	s := NewSupervisor("test", SupervisorOpt{
+		InitialBackoff:  time.Millisecond,
+		MaxBackoff:      time.Millisecond,
+		MaxAttempts:     2,
+		CircuitCooldown: 50 * time.Millisecond,
+	})
+
+	fail := errors.New("refused")
+	dialer := &fakeDialer{errs: []error{fail, fail, fail}}
+	s.Start(context.Background(), 0, []string{"btcidr"}, dialer.listen(s))
+
+	// the circuit opens after the second attempt
+	time.Sleep(25 * time.Millisecond)
+
+	if status := shardStatus(t, s, 0); status.State != entity.ShardStateFailed {
+		t.Fatalf("state = %s, want failed while the circuit is open", status.State)
+	}
+
+	waitStopped(t, s)
+
+	calls := dialer.attempts()
+	if len(calls) != 4 {
+		t.Fatalf("attempts = %d, want 4", len(calls))
+	}
+
+	if gap := calls[2].Sub(calls[1]); gap < 50*time.Millisecond {
+		t.Errorf("retried %s after the circuit opened, want at least the cooldown", gap)
+	}
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	s := NewSupervisor("test", SupervisorOpt{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		MaxAttempts:    2,
+	})
+
+	fail := errors.New("refused")
+	dialer := &fakeDialer{errs: []error{fail, fail, fail}}
+	s.Start(context.Background(), 0, []string{"btcidr"}, dialer.listen(s))
+
+	waitStopped(t, s)
+
+	if n := len(dialer.attempts()); n != 2 {
+		t.Fatalf("attempts = %d, want 2", n)
+	}
+
+	if status := shardStatus(t, s, 0); status.State != entity.ShardStateFailed {
+		t.Fatalf("state = %s, want failed", status.State)
+	}
+
+	// the pairs of the dead shard are free to be placed again
+	if _, ok := s.ShardOf("btcidr"); ok {
+		t.Error("pair still listened by a shard given up on")
+	}
+
+	placed, overflow := s.Place([]string{"btcidr"}, 10)
+	if len(placed) != 0 || len(overflow) != 1 {
+		t.Errorf("placed %v, overflow %v, want the pair left for a new shard", placed, overflow)
+	}
+}
+
+func TestSupervisorStableSessionResetsAttempts(t *testing.T) {
+	s := NewSupervisor("test", SupervisorOpt{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		MaxAttempts:    2,
+		StableAfter:    5 * time.Millisecond,
+	})
+
+	fail := errors.New("reset")
+	dialer := &fakeDialer{errs: []error{fail, fail, fail}, connectFor: 10 * time.Millisecond}
+	s.Start(context.Background(), 0, []string{"btcidr"}, dialer.listen(s))
+
+	waitStopped(t, s)
+
+	// every session was stable, so the circuit never opened
+	if n := len(dialer.attempts()); n != 4 {
+		t.Fatalf("attempts = %d, want 4", n)
+	}
+
+	if status := shardStatus(t, s, 0); status.Attempts != 1 {
+		t.Errorf("attempts = %d, want 1 after stable sessions", status.Attempts)
+	}
+}
+
+func TestSupervisorAttemptsGetCurrentPairs(t *testing.T) {
+	s := NewSupervisor("test", SupervisorOpt{InitialBackoff: 20 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	s.opt.Jitter = 0
+
+	dialer := &fakeDialer{errs: []error{errors.New("refused")}}
+	s.Start(context.Background(), 0, []string{"btcidr"}, dialer.listen(s))
+
+	// placed while the shard backs off
+	time.Sleep(5 * time.Millisecond)
+	s.Place([]string{"ethidr"}, 10)
+
+	waitStopped(t, s)
+
+	dialer.mu.Lock()
+	defer dialer.mu.Unlock()
+
+	if len(dialer.pairs) != 2 || len(dialer.pairs[1]) != 2 {
+		t.Errorf("pairs per attempt = %v, want the placed pair on the retry", dialer.pairs)
+	}
+}
+
+func TestSupervisorStopsWithContext(t *testing.T) {
+	s := NewSupervisor("test", SupervisorOpt{InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	dialer := &fakeDialer{errs: []error{errors.New("refused")}}
+	s.Start(ctx, 0, []string{"btcidr"}, dialer.listen(s))
+
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+
+	waitStopped(t, s)
+
+	if status := shardStatus(t, s, 0); status.State != entity.ShardStateStopped {
+		t.Errorf("state = %s, want stopped", status.State)
+	}
+}
@@ -0,0 +1,273 @@
+package bus
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type OverflowPolicy string
+
+const (
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+	OverflowBlock      OverflowPolicy = "block"
+)
+
+type SubscriberOpt struct {
+	Name         string
+	BufferSize   int
+	Policy       OverflowPolicy
+	BlockTimeout time.Duration // only used by OverflowBlock
+}
+
+type SubscriberStats struct {
+	Topic      string `json:"topic"`
+	Subscriber string `json:"subscriber"`
+	Queued     int    `json:"queued"`
+	Capacity   int    `json:"capacity"`
+	Dropped    uint64 `json:"dropped"`
+}
+
+type topicStatter interface {
+	stats() []SubscriberStats
+}
+
+// Bus is a registry of named in-process topics.
+type Bus struct {
+	topics map[string]topicStatter
+
+	mu sync.Mutex
+}
+
+func New() *Bus {
+	return &Bus{
+		topics: map[string]topicStatter{},
+	}
+}
+
+func (b *Bus) Stats() []SubscriberStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := []SubscriberStats{}
+
+	for _, t := range b.topics {
+		res = append(res, t.stats()...)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Topic != res[j].Topic {
+			return res[i].Topic < res[j].Topic
+		}
+
+		return res[i].Subscriber < res[j].Subscriber
+	})
+
+	return res
+}
+
+// Topic fans published values out to its subscribers, each with its own
+// bounded queue and overflow policy. The subscriber list is replaced rather
+// than modified, so Publish delivers without holding the topic lock.
+type Topic[T any] struct {
+	name        string
+	subscribers []*Subscriber[T]
+
+	mu sync.RWMutex
+}
+
+// NewTopic creates a topic and registers it on the bus. Registering the same
+// name twice panics, as it is a wiring mistake.
+func NewTopic[T any](b *Bus, name string) *Topic[T] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.topics[name]; ok {
+		panic(fmt.Sprintf("[bus][NewTopic] topic already registered: %s", name))
+	}
+
+	t := &Topic[T]{
+		name: name,
+	}
+
+	b.topics[name] = t
+
+	return t
+}
+
+func (t *Topic[T]) Name() string {
+	return t.name
+}
+
+func (t *Topic[T]) Subscribe(opt SubscriberOpt) (*Subscriber[T], error) {
+	if opt.BufferSize <= 0 {
+		return nil, fmt.Errorf("[bus][Topic][Subscribe] invalid buffer size: %d", opt.BufferSize)
+	}
+
+	switch opt.Policy {
+	case "":
+		opt.Policy = OverflowDropNewest
+	case OverflowDropOldest, OverflowDropNewest:
+	case OverflowBlock:
+		if opt.BlockTimeout <= 0 {
+			return nil, fmt.Errorf("[bus][Topic][Subscribe] block policy requires a positive timeout")
+		}
+	default:
+		return nil, fmt.Errorf("[bus][Topic][Subscribe] unknown overflow policy: %s", opt.Policy)
+	}
+
+	sub := &Subscriber[T]{
+		name:         opt.Name,
+		policy:       opt.Policy,
+		blockTimeout: opt.BlockTimeout,
+		ch:           make(chan T, opt.BufferSize),
+	}
+
+	t.mu.Lock()
+	t.subscribers = append(slices.Clip(t.subscribers), sub)
+	t.mu.Unlock()
+
+	return sub, nil
+}
+
+// Unsubscribe detaches the subscriber and closes its channel, once a delivery
+// blocked on it is done.
+func (t *Topic[T]) Unsubscribe(sub *Subscriber[T]) {
+	t.mu.Lock()
+	i := slices.Index(t.subscribers, sub)
+	if i < 0 {
+		t.mu.Unlock()
+		return
+	}
+	t.subscribers = slices.Concat(t.subscribers[:i], t.subscribers[i+1:])
+	t.mu.Unlock()
+
+	sub.closeMu.Lock()
+	defer sub.closeMu.Unlock()
+
+	sub.closed = true
+	close(sub.ch)
+}
+
+// Publish delivers v to every subscriber and returns how many of them
+// dropped a value because their queue was full. A subscriber blocking holds
+// up only this publisher, not the topic.
+func (t *Topic[T]) Publish(v T) int {
+	t.mu.RLock()
+	subscribers := t.subscribers
+	t.mu.RUnlock()
+
+	dropped := 0
+
+	for _, sub := range subscribers {
+		if !sub.deliver(v) {
+			dropped++
+		}
+	}
+
+	return dropped
+}
+
+func (t *Topic[T]) stats() []SubscriberStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	res := make([]SubscriberStats, 0, len(t.subscribers))
+
+	for _, sub := range t.subscribers {
+		res = append(res, SubscriberStats{
+			Topic:      t.name,
+			Subscriber: sub.name,
+			Queued:     len(sub.ch),
+			Capacity:   cap(sub.ch),
+			Dropped:    sub.Dropped(),
+		})
+	}
+
+	return res
+}
+
+type Subscriber[T any] struct {
+	name         string
+	policy       OverflowPolicy
+	blockTimeout time.Duration
+
+	ch      chan T
+	dropped atomic.Uint64
+
+	// closed is set by Unsubscribe, which waits for deliveries in progress
+	closed  bool
+	closeMu sync.RWMutex
+
+	mu sync.Mutex
+}
+
+func (s *Subscriber[T]) C() <-chan T {
+	return s.ch
+}
+
+func (s *Subscriber[T]) Name() string {
+	return s.name
+}
+
+func (s *Subscriber[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// deliver reports false when a value, new or queued, was dropped.
+func (s *Subscriber[T]) deliver(v T) bool {
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+
+	// unsubscribed after the publisher took the subscriber list
+	if s.closed {
+		return true
+	}
+
+	select {
+	case s.ch <- v:
+		return true
+	default:
+	}
+
+	switch s.policy {
+	case OverflowDropOldest:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delivered := true
+
+		for {
+			select {
+			case s.ch <- v:
+				return delivered
+			default:
+			}
+
+			select {
+			case <-s.ch:
+				s.dropped.Add(1)
+				delivered = false
+			default:
+			}
+		}
+	case OverflowBlock:
+		timer := time.NewTimer(s.blockTimeout)
+		defer timer.Stop()
+
+		select {
+		case s.ch <- v:
+			return true
+		case <-timer.C:
+			s.dropped.Add(1)
+			return false
+		}
+	default:
+		s.dropped.Add(1)
+		return false
+	}
+}
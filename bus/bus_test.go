@@ -0,0 +1,201 @@
+package bus
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func drain(ch <-chan int) []int {
+	values := []int{}
+
+	for {
+		select {
+		case v := <-ch:
+			values = append(values, v)
+		default:
+			return values
+		}
+	}
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		opt         SubscriberOpt
+		wantQueued  []int
+		wantDropped uint64
+		minDuration time.Duration
+	}{
+		{
+			name:        "drop newest",
+			opt:         SubscriberOpt{Name: "sub", BufferSize: 2, Policy: OverflowDropNewest},
+			wantQueued:  []int{1, 2},
+			wantDropped: 1,
+		},
+		{
+			name:        "default drops newest",
+			opt:         SubscriberOpt{Name: "sub", BufferSize: 2},
+			wantQueued:  []int{1, 2},
+			wantDropped: 1,
+		},
+		{
+			name:        "drop oldest",
+			opt:         SubscriberOpt{Name: "sub", BufferSize: 2, Policy: OverflowDropOldest},
+			wantQueued:  []int{2, 3},
+			wantDropped: 1,
+		},
+		{
+			name:        "block times out",
+			opt:         SubscriberOpt{Name: "sub", BufferSize: 2, Policy: OverflowBlock, BlockTimeout: 20 * time.Millisecond},
+			wantQueued:  []int{1, 2},
+			wantDropped: 1,
+			minDuration: 20 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New()
+			topic := NewTopic[int](b, "topic")
+
+			sub, err := topic.Subscribe(tt.opt)
+			if err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+
+			start := time.Now()
+
+			dropped := 0
+			for v := 1; v <= 3; v++ {
+				dropped += topic.Publish(v)
+			}
+
+			if elapsed := time.Since(start); elapsed < tt.minDuration {
+				t.Errorf("published in %s, want at least %s", elapsed, tt.minDuration)
+			}
+
+			if uint64(dropped) != tt.wantDropped || sub.Dropped() != tt.wantDropped {
+				t.Errorf("dropped %d, subscriber counted %d, want %d", dropped, sub.Dropped(), tt.wantDropped)
+			}
+
+			stats := b.Stats()
+			if len(stats) != 1 || stats[0].Dropped != tt.wantDropped || stats[0].Queued != 2 || stats[0].Capacity != 2 {
+				t.Errorf("stats = %+v", stats)
+			}
+
+			queued := drain(sub.C())
+			if len(queued) != len(tt.wantQueued) {
+				t.Fatalf("queued %v, want %v", queued, tt.wantQueued)
+			}
+
+			for i := range queued {
+				if queued[i] != tt.wantQueued[i] {
+					t.Errorf("queued %v, want %v", queued, tt.wantQueued)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestOverflowBlockWaitsForReader(t *testing.T) {
+	topic := NewTopic[int](New(), "topic")
+
+	sub, err := topic.Subscribe(SubscriberOpt{Name: "sub", BufferSize: 1, Policy: OverflowBlock, BlockTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	topic.Publish(1)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-sub.C()
+	}()
+
+	if dropped := topic.Publish(2); dropped != 0 {
+		t.Fatalf("dropped %d, want the publisher to wait for the reader", dropped)
+	}
+
+	if v := <-sub.C(); v != 2 {
+		t.Errorf("received %d, want 2", v)
+	}
+}
+
+func TestSubscribeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  SubscriberOpt
+	}{
+		{name: "no buffer", opt: SubscriberOpt{Name: "sub"}},
+		{name: "block without timeout", opt: SubscriberOpt{Name: "sub", BufferSize: 1, Policy: OverflowBlock}},
+		{name: "unknown policy", opt: SubscriberOpt{Name: "sub", BufferSize: 1, Policy: "drop_all"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topic := NewTopic[int](New(), "topic")
+
+			_, err := topic.Subscribe(tt.opt)
+			if err == nil {
+				t.Fatal("Subscribe succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestBlockedPublishDoesNotHoldTopic(t *testing.T) {
+	topic := NewTopic[int](New(), "topic")
+
+	blocked, err := topic.Subscribe(SubscriberOpt{Name: "blocked", BufferSize: 1, Policy: OverflowBlock, BlockTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	topic.Publish(1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		topic.Publish(2)
+	}()
+
+	// let the publisher block on the full queue
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+
+	go func() {
+		other, err := topic.Subscribe(SubscriberOpt{Name: "other", BufferSize: 1})
+		if err == nil {
+			topic.Unsubscribe(other)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("subscribing waited for the blocked publisher")
+	}
+
+	// the blocked delivery goes through once there is room
+	<-blocked.C()
+	wg.Wait()
+
+	if v := <-blocked.C(); v != 2 {
+		t.Errorf("received %d, want 2", v)
+	}
+
+	topic.Unsubscribe(blocked)
+
+	if _, ok := <-blocked.C(); ok {
+		t.Error("channel open after Unsubscribe")
+	}
+
+	// publishing after unsubscribing sends nothing on the closed channel
+	topic.Publish(3)
+}
@@ -1,7 +1,10 @@
 package common
 
 import (
+	"fmt"
 	"michaelyusak/go-market-ingestor.git/entity"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -38,9 +41,11 @@ func InitCandle(candle *entity.Candle, bucket int64, trade entity.TradeActivityV
 	candle.Exchange = trade.Exchange
 	candle.Symbol = trade.Symbol
 	candle.Open = trade.Price
+	candle.OpenEpoch = trade.Epoch
 	candle.High = trade.Price
 	candle.Low = trade.Price
 	candle.Close = trade.Price
+	candle.CloseEpoch = trade.Epoch
 	candle.Volume = entity.CandleVolume{
 		Total: trade.BaseVolume,
 	}
@@ -63,7 +68,16 @@ func UpdateOHLC(candle *entity.Candle, trade entity.TradeActivityV2) {
 		candle.Volume.Sell = candle.Volume.Sell.Add(trade.BaseVolume)
 	}
 
-	candle.Close = trade.Price
+	// trades of a batch are not ordered, e.g. backfills mixed with live ones
+	if trade.Epoch < candle.OpenEpoch {
+		candle.Open = trade.Price
+		candle.OpenEpoch = trade.Epoch
+	}
+
+	if trade.Epoch >= candle.CloseEpoch {
+		candle.Close = trade.Price
+		candle.CloseEpoch = trade.Epoch
+	}
 
 	if trade.Price.GreaterThan(candle.High) {
 		candle.High = trade.Price
@@ -73,3 +87,88 @@ func UpdateOHLC(candle *entity.Candle, trade entity.TradeActivityV2) {
 		candle.Low = trade.Price
 	}
 }
+
+// ParseInterval parses candle intervals such as 1m, 15m, 4h and 1d.
+func ParseInterval(interval string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(interval, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid interval: %s", interval)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	size, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval: %s", interval)
+	}
+
+	if size < time.Minute || size%time.Minute != 0 {
+		return 0, fmt.Errorf("interval must be a whole number of minutes: %s", interval)
+	}
+
+	return size, nil
+}
+
+// FormatInterval is the inverse of ParseInterval, e.g. 4h and 1d.
+func FormatInterval(size time.Duration) string {
+	day := 24 * time.Hour
+
+	switch {
+	case size%day == 0:
+		return fmt.Sprintf("%dd", size/day)
+	case size%time.Hour == 0:
+		return fmt.Sprintf("%dh", size/time.Hour)
+	default:
+		return fmt.Sprintf("%dm", size/time.Minute)
+	}
+}
+
+// AggregateCandles merges ascending candles into buckets of the given size.
+func AggregateCandles(candles []entity.Candle, size time.Duration) []entity.Candle {
+	sizeSec := int64(size.Seconds())
+
+	res := []entity.Candle{}
+
+	for _, candle := range candles {
+		bucket := candle.Epoch - (candle.Epoch % sizeSec)
+
+		if len(res) == 0 || res[len(res)-1].Epoch != bucket {
+			candle.Epoch = bucket
+			res = append(res, candle)
+			continue
+		}
+
+		MergeCandle(&res[len(res)-1], candle)
+	}
+
+	return res
+}
+
+// MergeCandle folds a candle of the same bucket into dst. Candles read back
+// from rows written before open_at existed have no OpenEpoch and never take
+// over the open.
+func MergeCandle(dst *entity.Candle, src entity.Candle) {
+	if src.OpenEpoch != 0 && src.OpenEpoch < dst.OpenEpoch {
+		dst.Open = src.Open
+		dst.OpenEpoch = src.OpenEpoch
+	}
+
+	if src.High.GreaterThan(dst.High) {
+		dst.High = src.High
+	}
+
+	if src.Low.LessThan(dst.Low) {
+		dst.Low = src.Low
+	}
+
+	if src.CloseEpoch >= dst.CloseEpoch {
+		dst.Close = src.Close
+		dst.CloseEpoch = src.CloseEpoch
+	}
+
+	dst.Volume.Total = dst.Volume.Total.Add(src.Volume.Total)
+	dst.Volume.Buy = dst.Volume.Buy.Add(src.Volume.Buy)
+	dst.Volume.Sell = dst.Volume.Sell.Add(src.Volume.Sell)
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"michaelyusak/go-market-ingestor.git/entity"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func trade(epoch int64, price int64) entity.TradeActivityV2 {
+	return entity.TradeActivityV2{
+		Exchange:   "indodax",
+		Symbol:     "btcidr",
+		Epoch:      epoch,
+		Price:      decimal.NewFromInt(price),
+		BaseVolume: decimal.NewFromInt(1),
+		Side:       entity.TradeSideBuy,
+	}
+}
+
+func TestUpdateOHLCOutOfOrder(t *testing.T) {
+	var candle entity.Candle
+
+	InitCandle(&candle, 60, trade(90, 20))
+	UpdateOHLC(&candle, trade(61, 10))
+	UpdateOHLC(&candle, trade(119, 30))
+	UpdateOHLC(&candle, trade(100, 25))
+
+	if !candle.Open.Equal(decimal.NewFromInt(10)) || candle.OpenEpoch != 61 {
+		t.Errorf("open = %s at %d, want 10 at 61", candle.Open, candle.OpenEpoch)
+	}
+
+	if !candle.Close.Equal(decimal.NewFromInt(30)) || candle.CloseEpoch != 119 {
+		t.Errorf("close = %s at %d, want 30 at 119", candle.Close, candle.CloseEpoch)
+	}
+}
+
+func TestMergeCandleOutOfOrder(t *testing.T) {
+	var later, earlier entity.Candle
+
+	InitCandle(&later, 0, trade(200, 20))
+	InitCandle(&earlier, 0, trade(100, 10))
+
+	MergeCandle(&later, earlier)
+
+	if !later.Open.Equal(decimal.NewFromInt(10)) || later.OpenEpoch != 100 {
+		t.Errorf("open = %s at %d, want 10 at 100", later.Open, later.OpenEpoch)
+	}
+
+	if !later.Close.Equal(decimal.NewFromInt(20)) || later.CloseEpoch != 200 {
+		t.Errorf("close = %s at %d, want 20 at 200", later.Close, later.CloseEpoch)
+	}
+
+	if !later.Volume.Total.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("volume = %s, want 2", later.Volume.Total)
+	}
+}
+
+func TestMergeCandleKeepsOpenOverLegacyRow(t *testing.T) {
+	var dst entity.Candle
+
+	InitCandle(&dst, 0, trade(100, 10))
+
+	// read back from a row written before open_at existed
+	legacy := entity.Candle{Open: decimal.NewFromInt(99), High: decimal.NewFromInt(99), Low: decimal.NewFromInt(99)}
+
+	MergeCandle(&dst, legacy)
+
+	if !dst.Open.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("open = %s, want 10", dst.Open)
+	}
+}
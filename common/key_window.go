@@ -0,0 +1,40 @@
+package common
+
+// KeyWindow remembers the most recent keys up to a fixed capacity, evicting
+// the oldest first. It is not safe for concurrent use.
+type KeyWindow struct {
+	keys  []string
+	set   map[string]struct{}
+	next  int
+	count int
+}
+
+func NewKeyWindow(capacity int) *KeyWindow {
+	return &KeyWindow{
+		keys: make([]string, capacity),
+		set:  make(map[string]struct{}, capacity),
+	}
+}
+
+// Seen reports whether key is already in the window, adding it otherwise.
+func (w *KeyWindow) Seen(key string) bool {
+	if _, ok := w.set[key]; ok {
+		return true
+	}
+
+	if len(w.keys) == 0 {
+		return false
+	}
+
+	if w.count == len(w.keys) {
+		delete(w.set, w.keys[w.next])
+	} else {
+		w.count++
+	}
+
+	w.keys[w.next] = key
+	w.set[key] = struct{}{}
+	w.next = (w.next + 1) % len(w.keys)
+
+	return false
+}
@@ -0,0 +1,14 @@
+package common
+
+import "strings"
+
+// ListenedSymbol is the symbol a listened pair is streamed under, as
+// "<exchange>:<pair>".
+func ListenedSymbol(exchange, pair string) string {
+	if exchange == "binance" {
+		// binance reports symbols in upper case
+		pair = strings.ToUpper(pair)
+	}
+
+	return exchange + ":" + pair
+}
@@ -7,9 +7,18 @@ import (
 )
 
 func CloseConn(conn *websocket.Conn) error {
+	return closeConn(conn, websocket.CloseNormalClosure, "bye")
+}
+
+// CloseConnGoingAway tells the peer the server is shutting down.
+func CloseConnGoingAway(conn *websocket.Conn) error {
+	return closeConn(conn, websocket.CloseGoingAway, "server shutting down")
+}
+
+func closeConn(conn *websocket.Conn, code int, text string) error {
 	err := conn.WriteMessage(
 		websocket.CloseMessage,
-		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"),
+		websocket.FormatCloseMessage(code, text),
 	)
 	if err != nil {
 		return err
@@ -8,6 +8,15 @@ import (
 	hEntity "github.com/michaelyusak/go-helper/entity"
 )
 
+type ReconnectConfig struct {
+	InitialBackoff  hEntity.Duration `json:"initial_backoff"`
+	MaxBackoff      hEntity.Duration `json:"max_backoff"`
+	Jitter          float64          `json:"jitter"` // 0 to 1
+	MaxAttempts     int              `json:"max_attempts"`
+	CircuitCooldown hEntity.Duration `json:"circuit_cooldown"`
+	StableAfter     hEntity.Duration `json:"stable_after"`
+}
+
 type IndodaxConfig struct {
 	BaseUrl                      string           `json:"base_url"`
 	PublicWsToken                string           `json:"public_ws_token"`
@@ -18,10 +27,14 @@ type IndodaxConfig struct {
 	TradeActivityWsChannelPrefix string           `json:"trade_activity_ws_channel_prefix"`
 	PairsToListen                map[string]bool  `json:"pairs_to_listen"`
 	Timeout                      hEntity.Duration `json:"timeout"`
+	Reconnect                    ReconnectConfig  `json:"reconnect"`
 }
 
 type BinanceConfig struct {
 	PairsToListen map[string]bool `json:"pairs_to_listen"`
+	DepthMode     string          `json:"depth_mode"` // "", "partial" or "diff"
+	DepthLevels   int             `json:"depth_levels"`
+	Reconnect     ReconnectConfig `json:"reconnect"`
 }
 
 type ExchangeConfig struct {
@@ -38,6 +51,85 @@ type ServiceConfig struct {
 	Port           string           `json:"port"`
 	GracefulPeriod hEntity.Duration `json:"graceful_period"`
 	Db             hEntity.DBConfig `json:"db"`
+	MigrateOnStart bool             `json:"migrate_on_start"`
+	AdminToken     string           `json:"admin_token"` // bearer token for /v1/admin, empty disables it
+	// a shard receiving nothing for longer marks the service unready
+	SilentThreshold hEntity.Duration `json:"silent_threshold"`
+	// only mark the service degraded on a silent shard, keeping it ready, for
+	// deployments listening to pairs that go quiet
+	SilentDegradesOnly bool `json:"silent_degrades_only"`
+	// deadline of the ordered shutdown that follows the graceful period
+	ShutdownTimeout hEntity.Duration `json:"shutdown_timeout"`
+}
+
+type BusSubscriberConfig struct {
+	BufferSize     int              `json:"buffer_size"`
+	OverflowPolicy string           `json:"overflow_policy"` // drop_oldest, drop_newest or block
+	BlockTimeout   hEntity.Duration `json:"block_timeout"`
+}
+
+type BusConfig struct {
+	Storage   BusSubscriberConfig `json:"storage"` // defaults to block for 5s before dropping
+	Stream    BusSubscriberConfig `json:"stream"`
+	Watchdog  BusSubscriberConfig `json:"watchdog"`
+	OrderBook BusSubscriberConfig `json:"order_book"`
+}
+
+type StorageConfig struct {
+	CandleRollups []string    `json:"candle_rollups"` // e.g. ["5m", "15m", "1h", "4h", "1d"]
+	Spool         SpoolConfig `json:"spool"`
+	// trades per INSERT statement of the sql writer, capped by the bind
+	// parameter limit
+	InsertChunkSize int `json:"insert_chunk_size"`
+	// store every batch of the sql writer in one transaction, all or nothing
+	InsertTransactional bool `json:"insert_transactional"`
+	// Writer picks how trades and candles are written: "sql" (default) or
+	// "ilp" to stream them to QuestDB, reading back over ilp.db
+	Writer string    `json:"writer"`
+	Ilp    IlpConfig `json:"ilp"`
+}
+
+// IlpConfig sets up the ilp writer. Trades and candles then live in QuestDB
+// only; service.db stays the postgres database of the migrations and pair
+// metadata, which QuestDB cannot run.
+type IlpConfig struct {
+	Protocol    string           `json:"protocol"` // tcp or http
+	Address     string           `json:"address"`  // e.g. localhost:9009 over tcp, localhost:9000 over http
+	Token       string           `json:"token"`    // bearer token over http
+	Timeout     hEntity.Duration `json:"timeout"`
+	RowsPerSend int              `json:"rows_per_send"`
+	// QuestDB over the postgres wire protocol, e.g. port 8812, to create the
+	// tables and read trades and candles back
+	Db hEntity.DBConfig `json:"db"`
+}
+
+// SpoolConfig sets up the local file trades are kept in while the database
+// is unavailable.
+type SpoolConfig struct {
+	Path             string           `json:"path"` // empty disables the spool
+	RetryInterval    hEntity.Duration `json:"retry_interval"`
+	MaxRetryInterval hEntity.Duration `json:"max_retry_interval"`
+	ChunkSize        int              `json:"chunk_size"` // trades written per replayed insert
+}
+
+type GapRepairConfig struct {
+	Interval hEntity.Duration `json:"interval"` // 0 disables the background job
+	Lookback hEntity.Duration `json:"lookback"`
+	MinGap   hEntity.Duration `json:"min_gap"`
+}
+
+type PairMetaConfig struct {
+	RefreshInterval hEntity.Duration `json:"refresh_interval"`
+}
+
+type WatchdogConfig struct {
+	Enabled           bool                        `json:"enabled"`
+	CheckInterval     hEntity.Duration            `json:"check_interval"`
+	DefaultMaxSilence hEntity.Duration            `json:"default_max_silence"`
+	MaxSilence        map[string]hEntity.Duration `json:"max_silence"` // keyed by exchange:symbol
+	AlertCooldown     hEntity.Duration            `json:"alert_cooldown"`
+	WebhookUrl        string                      `json:"webhook_url"`
+	WebhookTimeout    hEntity.Duration            `json:"webhook_timeout"`
 }
 
 type CorsConfig struct {
@@ -45,10 +137,15 @@ type CorsConfig struct {
 }
 
 type AppConfig struct {
-	Service  ServiceConfig  `json:"service"`
-	Log      LogConfig      `json:"log"`
-	Exchange ExchangeConfig `json:"exchange"`
-	Cors     CorsConfig     `json:"cors"`
+	Service   ServiceConfig   `json:"service"`
+	Log       LogConfig       `json:"log"`
+	Exchange  ExchangeConfig  `json:"exchange"`
+	Cors      CorsConfig      `json:"cors"`
+	Bus       BusConfig       `json:"bus"`
+	Storage   StorageConfig   `json:"storage"`
+	GapRepair GapRepairConfig `json:"gap_repair"`
+	PairMeta  PairMetaConfig  `json:"pair_meta"`
+	Watchdog  WatchdogConfig  `json:"watchdog"`
 }
 
 func Init() (AppConfig, error) {
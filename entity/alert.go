@@ -0,0 +1,12 @@
+package entity
+
+type StaleAlert struct {
+	Exchange     string `json:"exchange"`
+	Symbol       string `json:"symbol"`
+	LastTradeAt  int64  `json:"last_trade_at"` // in seconds, 0 when no trade was seen since startup
+	SilentFor    string `json:"silent_for"`
+	MaxSilence   string `json:"max_silence"`
+	Resubscribed bool   `json:"resubscribed"`
+	Error        string `json:"error,omitempty"`
+	RaisedAt     int64  `json:"raised_at"`
+}
@@ -14,8 +14,11 @@ type Candle struct {
 	Close    decimal.Decimal `json:"close"`
 	Volume   CandleVolume    `json:"volume"`
 
-	//internal
-	Dirty bool `json:"-"`
+	// OpenEpoch and CloseEpoch are when the trades that set Open and Close
+	// happened, in seconds, so merges keep the open of the earliest trade and
+	// the close of the latest whatever order they come in
+	OpenEpoch  int64 `json:"-"`
+	CloseEpoch int64 `json:"-"`
 }
 
 type CandleVolume struct {
@@ -23,3 +26,18 @@ type CandleVolume struct {
 	Buy   decimal.Decimal `json:"buy"`
 	Sell  decimal.Decimal `json:"sell"`
 }
+
+type GetCandlesReq struct {
+	Exchange string `form:"exchange" binding:"required"`
+	Symbol   string `form:"symbol" binding:"required"`
+	Interval string `form:"interval"` // e.g. 1m, 5m, 1h, 1d
+	From     int64  `form:"from"`     // in seconds, inclusive
+	To       int64  `form:"to"`       // in seconds, exclusive
+	Limit    int    `form:"limit"`
+	Cursor   string `form:"cursor"`
+}
+
+type GetCandlesRes struct {
+	Candles    []Candle `json:"candles"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,41 @@
+package entity
+
+type CandleGap struct {
+	Exchange string `json:"exchange"`
+	Symbol   string `json:"symbol"`
+	From     int64  `json:"from"` // in seconds, first missing minute
+	To       int64  `json:"to"`   // in seconds, exclusive
+	Minutes  int64  `json:"minutes"`
+}
+
+type GapRepairStatus string
+
+const (
+	GapRepairStatusBackfilled  GapRepairStatus = "backfilled"
+	GapRepairStatusNoTrades    GapRepairStatus = "no_trades" // the exchange had nothing in the gap
+	GapRepairStatusFailed      GapRepairStatus = "failed"
+	GapRepairStatusUnsupported GapRepairStatus = "unsupported"
+	GapRepairStatusOutOfRange  GapRepairStatus = "out_of_range" // the exchange no longer serves trades that old
+)
+
+type GapRepair struct {
+	Gap        CandleGap       `json:"gap"`
+	Status     GapRepairStatus `json:"status"`
+	Trades     int             `json:"trades"`
+	Error      string          `json:"error,omitempty"`
+	RepairedAt int64           `json:"repaired_at"`
+}
+
+type ScanGapsReq struct {
+	Symbols []string `form:"symbols" json:"symbols"` // exchange:symbol, defaults to every listened symbol
+	From    int64    `form:"from" json:"from"`       // in seconds, inclusive
+	To      int64    `form:"to" json:"to"`           // in seconds, exclusive
+}
+
+type ScanGapsRes struct {
+	Gaps []CandleGap `json:"gaps"`
+}
+
+type RepairGapsRes struct {
+	Repairs []GapRepair `json:"repairs"`
+}
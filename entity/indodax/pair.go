@@ -0,0 +1,15 @@
+package indodax
+
+import "github.com/shopspring/decimal"
+
+type IndodaxPair struct {
+	Id                   string          `json:"id"`
+	Symbol               string          `json:"symbol"`
+	BaseCurrency         string          `json:"base_currency"`
+	TradedCurrency       string          `json:"traded_currency"`
+	VolumePrecision      decimal.Decimal `json:"volume_precision"`
+	PricePrecision       decimal.Decimal `json:"price_precision"`
+	TradeMinBaseCurrency decimal.Decimal `json:"trade_min_base_currency"`
+	IsMaintenance        int             `json:"is_maintenance"`
+	IsMarketSuspended    int             `json:"is_market_suspended"`
+}
@@ -0,0 +1,9 @@
+package indodax
+
+type IndodaxTrade struct {
+	Date   string `json:"date"` // in seconds
+	Price  string `json:"price"`
+	Amount string `json:"amount"` // base asset
+	Tid    string `json:"tid"`
+	Type   string `json:"type"`
+}
@@ -0,0 +1,25 @@
+package entity
+
+import "github.com/shopspring/decimal"
+
+type OrderBookLevel struct {
+	Price decimal.Decimal `json:"price"` // price per base
+	Size  decimal.Decimal `json:"size"`  // always base asset
+}
+
+type OrderBook struct {
+	Epoch    int64  `json:"epoch"` // in seconds
+	Symbol   string `json:"symbol"`
+	Exchange string `json:"exchange"`
+
+	Bids []OrderBookLevel `json:"bids"` // best (highest) price first
+	Asks []OrderBookLevel `json:"asks"` // best (lowest) price first
+
+	Sequence int64 `json:"sequence"` // exchange sequence / offset
+}
+
+type GetOrderBookReq struct {
+	Exchange string `form:"exchange" binding:"required"`
+	Symbol   string `form:"symbol" binding:"required"`
+	Depth    int    `form:"depth"` // levels per side, 0 for all
+}
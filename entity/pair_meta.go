@@ -2,13 +2,37 @@ package entity
 
 import "github.com/shopspring/decimal"
 
+// PairMeta describes a pair as reported by its exchange. BaseCurrency is the
+// currency prices are quoted in (idr in btcidr) and TradedCurrency the one
+// being bought or sold, following Indodax naming.
 type PairMeta struct {
-	ID              string
-	BaseCurrency    string
-	TradedCurrency  string
-	PricePrecision  decimal.Decimal
-	VolumePrecision decimal.Decimal
-	MinBaseTrade    decimal.Decimal
-	IsSuspended     bool
-	IsMaintenance   bool
+	Exchange        string          `json:"exchange"`
+	ID              string          `json:"id"`
+	BaseCurrency    string          `json:"base_currency"`
+	TradedCurrency  string          `json:"traded_currency"`
+	PricePrecision  decimal.Decimal `json:"price_precision"`
+	VolumePrecision decimal.Decimal `json:"volume_precision"`
+	MinBaseTrade    decimal.Decimal `json:"min_base_trade"`
+	IsSuspended     bool            `json:"is_suspended"`
+	IsMaintenance   bool            `json:"is_maintenance"`
+	UpdatedAt       int64           `json:"updated_at"` // in seconds
+}
+
+func (m PairMeta) IsTradable() bool {
+	return !m.IsSuspended && !m.IsMaintenance
+}
+
+type GetPairsReq struct {
+	Exchange string `form:"exchange"`
+}
+
+type UpdatePairsReq struct {
+	Exchange string   `json:"exchange" binding:"required"`
+	Pairs    []string `json:"pairs" binding:"required,min=1"`
+}
+
+type UpdatePairsRes struct {
+	Exchange string   `json:"exchange"`
+	Updated  []string `json:"updated"`
+	Skipped  []string `json:"skipped"` // unknown, untradable or already in the wanted state
 }
@@ -0,0 +1,32 @@
+package entity
+
+type ShardState string
+
+const (
+	ShardStateConnecting   ShardState = "connecting"
+	ShardStateConnected    ShardState = "connected"
+	ShardStateReconnecting ShardState = "reconnecting"
+	ShardStateFailed       ShardState = "failed" // circuit open, waiting for the cooldown
+	ShardStateStopped      ShardState = "stopped"
+)
+
+type ShardStatus struct {
+	Exchange   string     `json:"exchange"`
+	ShardId    int        `json:"shard_id"`
+	Pairs      []string   `json:"pairs"`
+	State      ShardState `json:"state"`
+	StateSince int64      `json:"state_since"` // in seconds
+	Attempts   int        `json:"attempts"`    // consecutive failed attempts
+	LastError  string     `json:"last_error,omitempty"`
+
+	LastMessageAt     int64   `json:"last_message_at"` // in seconds, 0 when nothing was received yet
+	MessagesPerSecond float64 `json:"messages_per_second"`
+	Silent            bool    `json:"silent"`
+}
+
+type StatusRes struct {
+	Ready           bool          `json:"ready"`
+	Degraded        bool          `json:"degraded"` // some shard is silent
+	SilentThreshold string        `json:"silent_threshold"`
+	Shards          []ShardStatus `json:"shards"`
+}
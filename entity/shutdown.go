@@ -0,0 +1,14 @@
+package entity
+
+// ShutdownReport sums up a graceful shutdown. Anything counted as lost did
+// not make it to the database.
+type ShutdownReport struct {
+	TradesDrained     int  // read from the trade channels after the adapters stopped
+	TradesFlushed     int  // written by the final batch
+	TradesSpooled     int  // kept in the spool to be written on the next start
+	TradesLost        int  // buffered trades not written
+	TradesUnconfirmed int  // in the batch still being written at the deadline, neither stored nor spooled yet
+	CandlesLost       int  // 1m candles of the final batch not upserted
+	SubscribersClosed int  // stream websockets sent a close frame
+	TimedOut          bool // the deadline passed before the shutdown completed
+}
@@ -8,6 +8,7 @@ import (
 
 type CreateStreamReq struct {
 	CandleSize hEntity.Duration `json:"candle_size" form:"candle_size"`
+	Symbols    []string         `json:"symbols" form:"symbols"` // exchange:symbol, e.g. indodax:btcidr; empty for all listened symbols
 }
 
 type CreateStreamRes struct {
@@ -23,10 +24,17 @@ type WsMessage struct {
 type WsMessageType string
 
 const (
-	WsMessageTypeAuth WsMessageType = "auth"
+	WsMessageTypeAuth        WsMessageType = "auth"
+	WsMessageTypeSubscribe   WsMessageType = "subscribe"
+	WsMessageTypeUnsubscribe WsMessageType = "unsubscribe"
+	WsMessageTypeAlert       WsMessageType = "alert" // sent to subscribers of a stale symbol
 )
 
 type WsAuthData struct {
 	Channel string `json:"channel"`
 	Token   string `json:"token"`
 }
+
+type WsSymbolsData struct {
+	Symbols []string `json:"symbols"`
+}
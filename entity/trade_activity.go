@@ -1,6 +1,10 @@
 package entity
 
-import "github.com/shopspring/decimal"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 type TradeSide string
 
@@ -34,3 +38,32 @@ type TradeActivityV2 struct {
 
 	Key string `json:"key"`
 }
+
+type GetTradesReq struct {
+	Exchange string `form:"exchange" binding:"required"`
+	Symbol   string `form:"symbol" binding:"required"`
+	Side     string `form:"side"` // buy or sell, empty for both
+	From     int64  `form:"from"` // in seconds, inclusive
+	To       int64  `form:"to"`   // in seconds, exclusive
+	Limit    int    `form:"limit"`
+	Cursor   string `form:"cursor"`
+}
+
+type GetTradesRes struct {
+	Trades     []TradeActivityV2 `json:"trades"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+type TradesQuery struct {
+	Exchange string
+	Symbol   string
+	Side     TradeSide
+	From     time.Time
+	To       time.Time
+
+	// keyset pagination, trades strictly after (AfterEpoch, AfterKey)
+	AfterEpoch int64
+	AfterKey   string
+
+	Limit int
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Candle struct {
+	candleService service.Candle
+}
+
+func NewCandle(
+	candleService service.Candle,
+) *Candle {
+	return &Candle{
+		candleService: candleService,
+	}
+}
+
+func (h *Candle) GetCandles(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.GetCandlesReq
+
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	c := ctx.Request.Context()
+
+	res, err := h.candleService.GetCandles(c, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Gap struct {
+	gapService service.Gap
+}
+
+func NewGap(
+	gapService service.Gap,
+) *Gap {
+	return &Gap{
+		gapService: gapService,
+	}
+}
+
+func (h *Gap) ScanGaps(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.ScanGapsReq
+
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	c := ctx.Request.Context()
+
+	res, err := h.gapService.ScanGaps(c, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Gap) RepairGaps(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.ScanGapsReq
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	c := ctx.Request.Context()
+
+	res, err := h.gapService.RepairGaps(c, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Gap) GetRepairs(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	repairs := h.gapService.GetRepairs()
+
+	hHelper.ResponseOK(ctx, repairs)
+}
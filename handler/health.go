@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"michaelyusak/go-market-ingestor.git/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/michaelyusak/go-helper/apperror"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Health struct {
+	statusService service.Status
+}
+
+func NewHealth(
+	statusService service.Status,
+) *Health {
+	return &Health{
+		statusService: statusService,
+	}
+}
+
+func (h *Health) Health(ctx *gin.Context) {
+	if !h.statusService.Ready() {
+		ctx.Error(apperror.UnavailableError())
+		return
+	}
+
+	hHelper.ResponseOK(ctx, "ok")
+}
+
+func (h *Health) Status(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	res := h.statusService.GetStatus()
+
+	hHelper.ResponseOK(ctx, res)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Listener struct {
+	listenerService service.Listener
+}
+
+func NewListener(
+	listenerService service.Listener,
+) *Listener {
+	return &Listener{
+		listenerService: listenerService,
+	}
+}
+
+func (h *Listener) AddPairs(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.UpdatePairsReq
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	c := ctx.Request.Context()
+
+	res, err := h.listenerService.AddPairs(c, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Listener) RemovePairs(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.UpdatePairsReq
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	c := ctx.Request.Context()
+
+	res, err := h.listenerService.RemovePairs(c, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type OrderBook struct {
+	orderBookService service.OrderBook
+}
+
+func NewOrderBook(
+	orderBookService service.OrderBook,
+) *OrderBook {
+	return &OrderBook{
+		orderBookService: orderBookService,
+	}
+}
+
+func (h *OrderBook) GetOrderBook(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.GetOrderBookReq
+
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	c := ctx.Request.Context()
+
+	res, err := h.orderBookService.GetOrderBook(c, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
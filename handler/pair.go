@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Pair struct {
+	pairService service.Pair
+}
+
+func NewPair(
+	pairService service.Pair,
+) *Pair {
+	return &Pair{
+		pairService: pairService,
+	}
+}
+
+func (h *Pair) GetPairs(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.GetPairsReq
+
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	c := ctx.Request.Context()
+
+	res, err := h.pairService.GetPairs(c, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
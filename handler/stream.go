@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"michaelyusak/go-market-ingestor.git/common"
 	"michaelyusak/go-market-ingestor.git/entity"
 	"michaelyusak/go-market-ingestor.git/service"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gorilla/websocket"
 	hHelper "github.com/michaelyusak/go-helper/helper"
@@ -19,15 +21,49 @@ import (
 type Stream struct {
 	streamService service.Stream
 	upgrader      websocket.Upgrader
+	queueSize     int
+
+	// closing is done once the server shuts down, conns tracks the open
+	// websockets
+	closing   context.Context
+	closeAll  context.CancelFunc
+	conns     sync.WaitGroup
+	connCount atomic.Int64
 }
 
 func NewStream(
 	streamService service.Stream,
 	upgrader websocket.Upgrader,
 ) *Stream {
+	closing, closeAll := context.WithCancel(context.Background())
+
 	return &Stream{
 		streamService: streamService,
 		upgrader:      upgrader,
+		queueSize:     64,
+		closing:       closing,
+		closeAll:      closeAll,
+	}
+}
+
+// Close sends a close frame to every open stream and waits for them to end
+// until ctx is done. It returns the number of streams closed.
+func (h *Stream) Close(ctx context.Context) (int, error) {
+	count := int(h.connCount.Load())
+
+	h.closeAll()
+
+	done := make(chan struct{})
+	go func() {
+		h.conns.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return count, nil
+	case <-ctx.Done():
+		return count, fmt.Errorf("[handler][stream][Close] %d streams still open: %w", h.connCount.Load(), ctx.Err())
 	}
 }
 
@@ -61,10 +97,22 @@ func (h *Stream) Start(ctx *gin.Context) {
 	}
 	defer conn.Close()
 
+	h.conns.Add(1)
+	h.connCount.Add(1)
+	defer func() {
+		h.connCount.Add(-1)
+		h.conns.Done()
+	}()
+
 	c, done := context.WithCancel(ctx.Request.Context())
 	defer done()
 
-	dataCh := make(chan []byte)
+	// closing the conn ends the listener once the server shuts down
+	stopOnClose := context.AfterFunc(h.closing, done)
+	defer stopOnClose()
+
+	// the stream service drops messages instead of waiting on a busy writer
+	dataCh := make(chan []byte, h.queueSize)
 
 	var wg sync.WaitGroup
 	var channel, token string
@@ -104,16 +152,15 @@ func (h *Stream) Start(ctx *gin.Context) {
 		for {
 			messageType, message, err := conn.ReadMessage()
 			if err != nil {
-				if websocket.IsUnexpectedCloseError(err) {
-					done()
-					break loop
+				// read errors are permanent, the conn is gone
+				if !websocket.IsUnexpectedCloseError(err) && c.Err() == nil {
+					logrus.
+						WithError(err).
+						Warn("[handler][Replay][StreamReplay][Read][conn.ReadMessage]")
 				}
 
-				logrus.
-					WithError(err).
-					Warn("[handler][Replay][StreamReplay][Read][conn.ReadMessage]")
-
-				continue
+				done()
+				break loop
 			}
 
 			switch messageType {
@@ -169,7 +216,31 @@ func (h *Stream) Start(ctx *gin.Context) {
 					break loop
 				}
 
-				// Feature
+				if msg.Type == string(entity.WsMessageTypeSubscribe) || msg.Type == string(entity.WsMessageTypeUnsubscribe) {
+					var symbolsData entity.WsSymbolsData
+					err = json.Unmarshal(msg.Data, &symbolsData)
+					if err != nil {
+						logrus.
+							WithError(err).
+							WithField("raw", string(msg.Data)).
+							Warn("[handler][Replay][StreamReplay][Read][json.Unmarshal(msg.Data, &symbolsData)]")
+						continue loop
+					}
+
+					if msg.Type == string(entity.WsMessageTypeSubscribe) {
+						err = h.streamService.Subscribe(channel, token, symbolsData.Symbols)
+					} else {
+						err = h.streamService.Unsubscribe(channel, token, symbolsData.Symbols)
+					}
+					if err != nil {
+						logrus.
+							WithError(err).
+							WithField("channel", channel).
+							WithField("type", msg.Type).
+							Warn("[handler][Replay][StreamReplay][Read][streamService.UpdateSymbols]")
+						continue loop
+					}
+				}
 			}
 		}
 	}()
@@ -184,6 +255,11 @@ func (h *Stream) Start(ctx *gin.Context) {
 		h.streamService.Stop(channel, token)
 	}
 
+	if h.closing.Err() != nil {
+		common.CloseConnGoingAway(conn)
+		return
+	}
+
 	common.CloseConn(conn)
 }
 
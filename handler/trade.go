@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Trade struct {
+	tradeService service.Trade
+}
+
+func NewTrade(
+	tradeService service.Trade,
+) *Trade {
+	return &Trade{
+		tradeService: tradeService,
+	}
+}
+
+func (h *Trade) GetTrades(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.GetTradesReq
+
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	c := ctx.Request.Context()
+
+	res, err := h.tradeService.GetTrades(c, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
@@ -1,7 +1,16 @@
 package main
 
-import "michaelyusak/go-market-ingestor.git/server"
+import (
+	"os"
+
+	"michaelyusak/go-market-ingestor.git/server"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		server.Migrate(os.Args[2:])
+		return
+	}
+
 	server.Init()
 }
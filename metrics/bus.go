@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"michaelyusak/go-market-ingestor.git/bus"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	busDroppedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bus", "dropped_total"),
+		"Values dropped by a full subscriber queue, per topic and subscriber.",
+		[]string{"topic", "subscriber"}, nil,
+	)
+
+	busQueuedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bus", "queued"),
+		"Values waiting in a subscriber queue.",
+		[]string{"topic", "subscriber"}, nil,
+	)
+
+	busCapacityDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bus", "capacity"),
+		"Size of a subscriber queue.",
+		[]string{"topic", "subscriber"}, nil,
+	)
+)
+
+// busCollector reads the subscriber stats of a bus on every scrape.
+type busCollector struct {
+	bus *bus.Bus
+}
+
+// RegisterBus exports the per subscriber stats of b.
+func RegisterBus(b *bus.Bus) {
+	prometheus.MustRegister(&busCollector{bus: b})
+}
+
+func (c *busCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- busDroppedDesc
+	ch <- busQueuedDesc
+	ch <- busCapacityDesc
+}
+
+func (c *busCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, stats := range c.bus.Stats() {
+		ch <- prometheus.MustNewConstMetric(busDroppedDesc, prometheus.CounterValue, float64(stats.Dropped), stats.Topic, stats.Subscriber)
+		ch <- prometheus.MustNewConstMetric(busQueuedDesc, prometheus.GaugeValue, float64(stats.Queued), stats.Topic, stats.Subscriber)
+		ch <- prometheus.MustNewConstMetric(busCapacityDesc, prometheus.GaugeValue, float64(stats.Capacity), stats.Topic, stats.Subscriber)
+	}
+}
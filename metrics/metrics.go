@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "market_ingestor"
+
+var (
+	TradesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "trades_received_total",
+		Help:      "Trades received from exchange websockets.",
+	}, []string{"exchange", "symbol"})
+
+	BroadcastDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broadcast_dropped_total",
+		Help:      "Trade broadcasts dropped by a full subscriber queue.",
+	}, []string{"exchange"})
+
+	StorageBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_batch_size",
+		Help:      "Trades per storage batch.",
+		Buckets:   prometheus.ExponentialBuckets(10, 4, 9),
+	})
+
+	StorageBatchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_batch_duration_seconds",
+		Help:      "Time spent persisting a storage batch, per step.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"step"})
+
+	DbErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_errors_total",
+		Help:      "Failed database calls per repository method.",
+	}, []string{"repository", "method"})
+
+	StreamSubscribers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stream_subscribers",
+		Help:      "Active candle stream websocket subscribers per candle size.",
+	}, []string{"size"})
+
+	CandlesEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "candles_emitted_total",
+		Help:      "Candles sent to stream subscribers per candle size.",
+	}, []string{"size"})
+
+	StreamMessagesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stream_messages_dropped_total",
+		Help:      "Stream messages dropped by a full subscriber queue per candle size.",
+	}, []string{"size"})
+
+	SpoolRecords = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "spool_records",
+		Help:      "Trades waiting in the spool to be written to the database.",
+	})
+
+	SpoolBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "spool_bytes",
+		Help:      "Size of the spool files.",
+	})
+
+	SpoolTrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spool_trades_total",
+		Help:      "Trades appended to or replayed from the spool.",
+	}, []string{"op"})
+)
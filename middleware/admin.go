@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/michaelyusak/go-helper/appconstant"
+	"github.com/michaelyusak/go-helper/dto"
+	"github.com/sirupsen/logrus"
+)
+
+// AdminAuth only lets through requests carrying "Bearer <token>". An empty
+// token disables the admin routes entirely.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.Request.Header.Get(appconstant.Authorization)
+
+		bearer, found := strings.CutPrefix(authorization, appconstant.Bearer+" ")
+		if token == "" || !found || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			logrus.
+				WithField("path", c.Request.URL.Path).
+				Warn("[middleware][AdminAuth] unauthorized admin request")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{StatusCode: http.StatusUnauthorized, Message: appconstant.MsgUnauthorized})
+			return
+		}
+
+		c.Next()
+	}
+}
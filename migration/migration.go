@@ -0,0 +1,284 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// advisoryLockId keeps concurrently starting instances from migrating at the
+// same time.
+const advisoryLockId = 7_381_925_001
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+type migrator struct {
+	db   *sql.DB
+	fsys fs.FS
+}
+
+// NewMigrator reads migrations named <version>_<name>.up.sql and
+// <version>_<name>.down.sql from the root of fsys.
+func NewMigrator(db *sql.DB, fsys fs.FS) *migrator {
+	return &migrator{
+		db:   db,
+		fsys: fsys,
+	}
+}
+
+func (m *migrator) load() ([]migration, error) {
+	entries, err := fs.ReadDir(m.fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("[migration][load][fs.ReadDir] %w", err)
+	}
+
+	byVersion := map[int]*migration{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		fileName := entry.Name()
+
+		var direction string
+		base, ok := strings.CutSuffix(fileName, ".up.sql")
+		if ok {
+			direction = "up"
+		} else if base, ok = strings.CutSuffix(fileName, ".down.sql"); ok {
+			direction = "down"
+		} else {
+			continue
+		}
+
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("[migration][load] invalid migration file name: %s", fileName)
+		}
+
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("[migration][load] invalid migration version: %s", fileName)
+		}
+
+		content, err := fs.ReadFile(m.fsys, fileName)
+		if err != nil {
+			return nil, fmt.Errorf("[migration][load][fs.ReadFile] %w", err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{version: version, name: name}
+			byVersion[version] = mig
+		}
+
+		if mig.name != name {
+			return nil, fmt.Errorf("[migration][load] conflicting names for version %d: %s, %s", version, mig.name, name)
+		}
+
+		switch direction {
+		case "up":
+			mig.up = string(content)
+		case "down":
+			mig.down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" {
+			return nil, fmt.Errorf("[migration][load] missing up migration for version %d", mig.version)
+		}
+
+		migrations = append(migrations, *mig)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+func (m *migrator) prepare(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("[migration][prepare][conn.ExecContext] create migrations table: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("[migration][prepare][conn.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+
+	for rows.Next() {
+		var version int
+
+		err := rows.Scan(&version)
+		if err != nil {
+			return nil, fmt.Errorf("[migration][prepare][rows.Scan] %w", err)
+		}
+
+		applied[version] = true
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("[migration][prepare][rows.Err] %w", err)
+	}
+
+	return applied, nil
+}
+
+func (m *migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("[migration][withLock][db.Conn] %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockId)
+	if err != nil {
+		return fmt.Errorf("[migration][withLock][pg_advisory_lock] %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockId)
+
+	return fn(conn)
+}
+
+func (m *migrator) apply(ctx context.Context, conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("[migration][apply][conn.BeginTx] %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return fmt.Errorf("[migration][apply][tx.ExecContext] %w", err)
+	}
+
+	err = record(tx)
+	if err != nil {
+		return fmt.Errorf("[migration][apply][record] %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("[migration][apply][tx.Commit] %w", err)
+	}
+
+	return nil
+}
+
+// Up applies every pending migration in version order and returns the
+// versions it applied.
+func (m *migrator) Up(ctx context.Context) ([]int, error) {
+	migrations, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []int{}
+
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.prepare(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range migrations {
+			if done[mig.version] {
+				continue
+			}
+
+			err := m.apply(ctx, conn, mig.up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.version, mig.name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("[migration][Up] version %d (%s): %w", mig.version, mig.name, err)
+			}
+
+			logrus.
+				WithField("version", mig.version).
+				WithField("name", mig.name).
+				Info("[migration][Up] migration applied")
+
+			applied = append(applied, mig.version)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the latest steps applied migrations and returns the versions
+// it reverted.
+func (m *migrator) Down(ctx context.Context, steps int) ([]int, error) {
+	migrations, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := []int{}
+
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.prepare(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := migrations[i]
+
+			if !done[mig.version] {
+				continue
+			}
+
+			if mig.down == "" {
+				return fmt.Errorf("[migration][Down] missing down migration for version %d", mig.version)
+			}
+
+			err := m.apply(ctx, conn, mig.down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("[migration][Down] version %d (%s): %w", mig.version, mig.name, err)
+			}
+
+			logrus.
+				WithField("version", mig.version).
+				WithField("name", mig.name).
+				Info("[migration][Down] migration reverted")
+
+			reverted = append(reverted, mig.version)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
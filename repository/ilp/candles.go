@@ -0,0 +1,180 @@
+package ilp
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/common"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/metrics"
+	"time"
+)
+
+type candles struct {
+	sender      *Sender
+	db          *sql.DB
+	rowsPerSend int
+}
+
+// NewCandles writes candles over ILP and reads them back over SQL.
+//
+// ILP cannot merge into a stored row, so every upsert appends the candle as
+// given and GetRange folds the rows of a bucket together: first open, highest
+// high, lowest low, last close and summed volumes, close to the merge the SQL
+// repository does on conflict. Rows of a bucket share their timestamp, so the
+// first open and last close are those written first and last rather than
+// those of the earliest and latest trades.
+func NewCandles(sender *Sender, db *sql.DB, rowsPerSend int) *candles {
+	if rowsPerSend <= 0 {
+		rowsPerSend = 10000
+	}
+
+	return &candles{
+		sender:      sender,
+		db:          db,
+		rowsPerSend: rowsPerSend,
+	}
+}
+
+func candlesTable(size time.Duration) (string, error) {
+	if size < time.Minute || size%time.Minute != 0 {
+		return "", fmt.Errorf("invalid candle size: %s", size.String())
+	}
+
+	return "candles_" + common.FormatInterval(size), nil
+}
+
+// EnsureTable creates the table for a resolution, without deduplication as
+// rows of a bucket are merged on read.
+func (r *candles) EnsureTable(ctx context.Context, size time.Duration) error {
+	table, err := candlesTable(size)
+	if err != nil {
+		return fmt.Errorf("[repository][ilp][candles][EnsureTable][candlesTable] %w", err)
+	}
+
+	q := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			timestamp TIMESTAMP,
+			exchange SYMBOL,
+			symbol SYMBOL,
+			open DOUBLE,
+			high DOUBLE,
+			low DOUBLE,
+			close DOUBLE,
+			volume DOUBLE,
+			buy_volume DOUBLE,
+			sell_volume DOUBLE
+		) TIMESTAMP(timestamp) PARTITION BY DAY WAL
+	`, table)
+
+	_, err = r.db.ExecContext(ctx, q)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("candles", "EnsureTable").Inc()
+		return fmt.Errorf("[repository][ilp][candles][EnsureTable][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// UpsertMany appends candles in chunks of rowsPerSend rows, each with the
+// bucket start as designated timestamp.
+func (r *candles) UpsertMany(ctx context.Context, size time.Duration, candles []entity.Candle) error {
+	table, err := candlesTable(size)
+	if err != nil {
+		return fmt.Errorf("[repository][ilp][candles][UpsertMany][candlesTable] %w", err)
+	}
+
+	var buf lineBuffer
+
+	for i, candle := range candles {
+		buf.table(table).
+			symbol("exchange", candle.Exchange).
+			symbol("symbol", candle.Symbol).
+			decimalColumn("open", candle.Open).
+			decimalColumn("high", candle.High).
+			decimalColumn("low", candle.Low).
+			decimalColumn("close", candle.Close).
+			decimalColumn("volume", candle.Volume.Total).
+			decimalColumn("buy_volume", candle.Volume.Buy).
+			decimalColumn("sell_volume", candle.Volume.Sell).
+			at(candle.Epoch)
+
+		if buf.len() < r.rowsPerSend && i < len(candles)-1 {
+			continue
+		}
+
+		err := r.sender.send(ctx, buf.bytes())
+		if err != nil {
+			metrics.DbErrors.WithLabelValues("candles", "UpsertMany").Inc()
+			return fmt.Errorf("[repository][ilp][candles][UpsertMany][sender.send] %w", err)
+		}
+
+		buf.reset()
+	}
+
+	return nil
+}
+
+func (r *candles) GetRange(ctx context.Context, size time.Duration, exchange, symbol string, from, to time.Time, limit int) ([]entity.Candle, error) {
+	table, err := candlesTable(size)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][ilp][candles][GetRange][candlesTable] %w", err)
+	}
+
+	q := fmt.Sprintf(`
+		SELECT timestamp, exchange, symbol,
+			first(open), max(high), min(low), last(close),
+			sum(volume), sum(buy_volume), sum(sell_volume)
+		FROM %s
+		WHERE exchange = $1
+			AND symbol = $2
+			AND timestamp >= $3
+			AND timestamp < $4
+		GROUP BY timestamp, exchange, symbol
+		ORDER BY timestamp ASC
+		LIMIT $5
+	`, table)
+
+	rows, err := r.db.QueryContext(ctx, q, exchange, symbol, from, to, limit)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("candles", "GetRange").Inc()
+		return nil, fmt.Errorf("[repository][ilp][candles][GetRange][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	candles := []entity.Candle{}
+
+	for rows.Next() {
+		var candle entity.Candle
+		var candleTs time.Time
+
+		err := rows.Scan(
+			&candleTs,
+			&candle.Exchange,
+			&candle.Symbol,
+			&candle.Open,
+			&candle.High,
+			&candle.Low,
+			&candle.Close,
+			&candle.Volume.Total,
+			&candle.Volume.Buy,
+			&candle.Volume.Sell,
+		)
+		if err != nil {
+			metrics.DbErrors.WithLabelValues("candles", "GetRange").Inc()
+			return nil, fmt.Errorf("[repository][ilp][candles][GetRange][rows.Scan] error: %w", err)
+		}
+
+		candle.Epoch = candleTs.Unix()
+
+		candles = append(candles, candle)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("candles", "GetRange").Inc()
+		return nil, fmt.Errorf("[repository][ilp][candles][GetRange][rows.Err] error: %w", err)
+	}
+
+	return candles, nil
+}
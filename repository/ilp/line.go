@@ -0,0 +1,101 @@
+package ilp
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	tableEscaper  = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper    = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// lineBuffer builds InfluxDB line protocol rows:
+//
+//	table,symbol=value,... column=value,... timestamp
+//
+// Tags land in SYMBOL columns and the timestamp in the designated timestamp.
+type lineBuffer struct {
+	sb     strings.Builder
+	lines  int
+	fields int
+}
+
+func (b *lineBuffer) table(name string) *lineBuffer {
+	if b.sb.Len() > 0 {
+		b.sb.WriteByte('\n')
+	}
+
+	b.sb.WriteString(tableEscaper.Replace(name))
+	b.fields = 0
+
+	return b
+}
+
+func (b *lineBuffer) symbol(name, value string) *lineBuffer {
+	b.sb.WriteByte(',')
+	b.sb.WriteString(tagEscaper.Replace(name))
+	b.sb.WriteByte('=')
+	b.sb.WriteString(tagEscaper.Replace(value))
+
+	return b
+}
+
+func (b *lineBuffer) column(name string) {
+	if b.fields == 0 {
+		b.sb.WriteByte(' ')
+	} else {
+		b.sb.WriteByte(',')
+	}
+	b.fields++
+
+	b.sb.WriteString(tagEscaper.Replace(name))
+	b.sb.WriteByte('=')
+}
+
+// decimalColumn is written as a float, numbers without the i suffix always
+// are, and lands in a DOUBLE column.
+func (b *lineBuffer) decimalColumn(name string, value decimal.Decimal) *lineBuffer {
+	b.column(name)
+	b.sb.WriteString(value.String())
+
+	return b
+}
+
+func (b *lineBuffer) stringColumn(name, value string) *lineBuffer {
+	b.column(name)
+	b.sb.WriteByte('"')
+	b.sb.WriteString(stringEscaper.Replace(value))
+	b.sb.WriteByte('"')
+
+	return b
+}
+
+// at ends the row with its designated timestamp in seconds.
+func (b *lineBuffer) at(epoch int64) {
+	b.sb.WriteByte(' ')
+	b.sb.WriteString(strconv.FormatInt(epoch*1e9, 10))
+	b.lines++
+}
+
+func (b *lineBuffer) len() int {
+	return b.lines
+}
+
+// bytes returns the rows, newline terminated.
+func (b *lineBuffer) bytes() []byte {
+	if b.sb.Len() == 0 {
+		return nil
+	}
+
+	return []byte(b.sb.String() + "\n")
+}
+
+func (b *lineBuffer) reset() {
+	b.sb.Reset()
+	b.lines = 0
+	b.fields = 0
+}
@@ -0,0 +1,83 @@
+package ilp
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestLineBufferEscaping(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *lineBuffer)
+		want  string
+	}{
+		{
+			name: "table",
+			build: func(b *lineBuffer) {
+				b.table("my trades,v2").symbol("a", "b").at(0)
+			},
+			want: `my\ trades\,v2,a=b 0` + "\n",
+		},
+		{
+			name: "symbol",
+			build: func(b *lineBuffer) {
+				b.table("t").symbol("pair name", `btc,idr=x\y`).at(0)
+			},
+			want: `t,pair\ name=btc\,idr\=x\\y 0` + "\n",
+		},
+		{
+			name: "string column",
+			build: func(b *lineBuffer) {
+				b.table("t").stringColumn("key", "say \"hi\"\n\\").at(0)
+			},
+			want: `t key="say \"hi\"\n\\" 0` + "\n",
+		},
+		{
+			name: "columns",
+			build: func(b *lineBuffer) {
+				b.table("t").
+					symbol("exchange", "binance").
+					decimalColumn("price", decimal.RequireFromString("0.000123")).
+					stringColumn("key", "k").
+					at(0)
+			},
+			want: `t,exchange=binance price=0.000123,key="k" 0` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf lineBuffer
+			tt.build(&buf)
+
+			if got := string(buf.bytes()); got != tt.want {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineBufferTimestamps(t *testing.T) {
+	var buf lineBuffer
+
+	buf.table("t").symbol("s", "a").decimalColumn("v", decimal.NewFromInt(1)).at(1700000000)
+	buf.table("t").symbol("s", "b").decimalColumn("v", decimal.NewFromInt(2)).at(1700000060)
+
+	want := "t,s=a v=1 1700000000000000000\n" +
+		"t,s=b v=2 1700000060000000000\n"
+
+	if got := string(buf.bytes()); got != want {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+
+	if buf.len() != 2 {
+		t.Errorf("len = %d, want 2", buf.len())
+	}
+
+	buf.reset()
+
+	if buf.bytes() != nil || buf.len() != 0 {
+		t.Errorf("after reset rows = %q, len = %d, want empty", buf.bytes(), buf.len())
+	}
+}
@@ -0,0 +1,142 @@
+package ilp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	ProtocolTcp  = "tcp"
+	ProtocolHttp = "http"
+)
+
+type SenderOpt struct {
+	Protocol string // tcp or http
+	// host:port of the ILP endpoint, e.g. localhost:9009 over tcp or
+	// localhost:9000 over http
+	Address string
+	Token   string // bearer token for http, empty for none
+	Timeout time.Duration
+}
+
+// Sender writes line protocol rows to QuestDB. Over tcp rows are streamed on
+// a long lived connection, redialed after a failed write, and QuestDB does not
+// acknowledge them. Over http every send is one request committed as a whole.
+type Sender struct {
+	opt SenderOpt
+
+	client *resty.Client
+	conn   net.Conn
+
+	mu sync.Mutex
+}
+
+func NewSender(opt SenderOpt) (*Sender, error) {
+	if opt.Timeout <= 0 {
+		opt.Timeout = 10 * time.Second
+	}
+
+	s := &Sender{
+		opt: opt,
+	}
+
+	switch opt.Protocol {
+	case ProtocolTcp:
+	case ProtocolHttp:
+		s.client = resty.New().SetTimeout(opt.Timeout)
+	default:
+		return nil, fmt.Errorf("[repository][ilp][NewSender] unknown protocol: %s", opt.Protocol)
+	}
+
+	return s, nil
+}
+
+func (s *Sender) send(ctx context.Context, rows []byte) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if s.opt.Protocol == ProtocolHttp {
+		return s.post(ctx, rows)
+	}
+
+	return s.write(ctx, rows)
+}
+
+func (s *Sender) write(ctx context.Context, rows []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		dialer := net.Dialer{Timeout: s.opt.Timeout}
+
+		conn, err := dialer.DialContext(ctx, "tcp", s.opt.Address)
+		if err != nil {
+			return fmt.Errorf("[repository][ilp][Sender][write][dialer.DialContext] %w", err)
+		}
+
+		s.conn = conn
+	}
+
+	deadline := time.Now().Add(s.opt.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	err := s.conn.SetWriteDeadline(deadline)
+	if err == nil {
+		_, err = s.conn.Write(rows)
+	}
+	if err != nil {
+		// rows may have been written in part, the next send starts afresh
+		s.conn.Close()
+		s.conn = nil
+
+		return fmt.Errorf("[repository][ilp][Sender][write][conn.Write] %w", err)
+	}
+
+	return nil
+}
+
+func (s *Sender) post(ctx context.Context, rows []byte) error {
+	req := s.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "text/plain; charset=utf-8").
+		SetQueryParam("precision", "n").
+		SetBody(rows)
+
+	if s.opt.Token != "" {
+		req.SetAuthToken(s.opt.Token)
+	}
+
+	res, err := req.Post(fmt.Sprintf("http://%s/write", s.opt.Address))
+	if err != nil {
+		return fmt.Errorf("[repository][ilp][Sender][post][req.Post] %w", err)
+	}
+
+	if res.StatusCode() != http.StatusNoContent && res.StatusCode() != http.StatusOK {
+		return fmt.Errorf("[repository][ilp][Sender][post] status %d: %s", res.StatusCode(), res.String())
+	}
+
+	return nil
+}
+
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
@@ -0,0 +1,211 @@
+package ilp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listen accepts tcp connections and hands every line received to the
+// returned channel, with the index of the connection it came on.
+func listen(t *testing.T) (string, <-chan [2]string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	lines := make(chan [2]string, 10)
+
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn, id string) {
+				defer conn.Close()
+
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- [2]string{id, scanner.Text()}
+				}
+			}(conn, strconv.Itoa(i))
+		}
+	}()
+
+	return ln.Addr().String(), lines
+}
+
+func waitLine(t *testing.T, lines <-chan [2]string) (string, string) {
+	t.Helper()
+
+	select {
+	case line := <-lines:
+		return line[0], line[1]
+	case <-time.After(time.Second):
+		t.Fatal("no line received")
+		return "", ""
+	}
+}
+
+func TestSenderWrite(t *testing.T) {
+	addr, lines := listen(t)
+
+	s, err := NewSender(SenderOpt{Protocol: ProtocolTcp, Address: addr, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewSender: %v", err)
+	}
+	defer s.Close()
+
+	err = s.send(context.Background(), []byte("t v=1 1\nt v=2 2\n"))
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	for _, want := range []string{"t v=1 1", "t v=2 2"} {
+		if _, got := waitLine(t, lines); got != want {
+			t.Errorf("line = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSenderWriteRedialsAfterFailure(t *testing.T) {
+	addr, lines := listen(t)
+
+	s, err := NewSender(SenderOpt{Protocol: ProtocolTcp, Address: addr, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewSender: %v", err)
+	}
+	defer s.Close()
+
+	err = s.send(context.Background(), []byte("t v=1 1\n"))
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	first, _ := waitLine(t, lines)
+
+	// break the connection under the sender
+	s.conn.Close()
+
+	err = s.send(context.Background(), []byte("t v=2 2\n"))
+	if err == nil {
+		t.Fatal("send on a broken connection succeeded, want error")
+	}
+
+	if s.conn != nil {
+		t.Fatal("broken connection kept")
+	}
+
+	err = s.send(context.Background(), []byte("t v=3 3\n"))
+	if err != nil {
+		t.Fatalf("send after redial: %v", err)
+	}
+
+	second, line := waitLine(t, lines)
+	if line != "t v=3 3" {
+		t.Errorf("line = %q, want %q", line, "t v=3 3")
+	}
+
+	if second == first {
+		t.Errorf("rows sent on connection %s again, want a new connection", first)
+	}
+}
+
+func TestSenderWriteDialError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s, err := NewSender(SenderOpt{Protocol: ProtocolTcp, Address: addr, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewSender: %v", err)
+	}
+
+	err = s.send(context.Background(), []byte("t v=1 1\n"))
+	if err == nil {
+		t.Fatal("send without a listener succeeded, want error")
+	}
+}
+
+func TestSenderPost(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "no content", status: http.StatusNoContent},
+		{name: "ok", status: http.StatusOK},
+		{name: "rejected", status: http.StatusBadRequest, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body, path, precision, auth, contentType string
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+
+				body = string(data)
+				path = r.URL.Path
+				precision = r.URL.Query().Get("precision")
+				auth = r.Header.Get("Authorization")
+				contentType = r.Header.Get("Content-Type")
+
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			s, err := NewSender(SenderOpt{
+				Protocol: ProtocolHttp,
+				Address:  strings.TrimPrefix(srv.URL, "http://"),
+				Token:    "secret",
+			})
+			if err != nil {
+				t.Fatalf("NewSender: %v", err)
+			}
+
+			err = s.send(context.Background(), []byte("t v=1 1\n"))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("send succeeded, want error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("send: %v", err)
+			}
+
+			if path != "/write" || precision != "n" {
+				t.Errorf("request to %s?precision=%s, want /write?precision=n", path, precision)
+			}
+
+			if auth != "Bearer secret" {
+				t.Errorf("authorization = %q, want %q", auth, "Bearer secret")
+			}
+
+			if !strings.HasPrefix(contentType, "text/plain") {
+				t.Errorf("content type = %q, want text/plain", contentType)
+			}
+
+			if body != "t v=1 1\n" {
+				t.Errorf("body = %q, want %q", body, "t v=1 1\n")
+			}
+		})
+	}
+}
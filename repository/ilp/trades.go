@@ -0,0 +1,97 @@
+package ilp
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/metrics"
+	"michaelyusak/go-market-ingestor.git/repository"
+	"michaelyusak/go-market-ingestor.git/repository/quest"
+)
+
+type trades struct {
+	sender      *Sender
+	db          *sql.DB
+	reader      repository.Trades
+	rowsPerSend int
+}
+
+// NewTrades writes trades over ILP and reads them back over SQL, QuestDB
+// serving both on the same tables.
+func NewTrades(sender *Sender, db *sql.DB, rowsPerSend int) *trades {
+	if rowsPerSend <= 0 {
+		rowsPerSend = 10000
+	}
+
+	return &trades{
+		sender:      sender,
+		db:          db,
+		reader:      quest.NewTrades(db, quest.TradesOpt{}),
+		rowsPerSend: rowsPerSend,
+	}
+}
+
+// EnsureTable creates the trades table with exchange, symbol and side as
+// SYMBOL columns. Deduplication on (timestamp, exchange, key) makes writing a
+// trade twice, e.g. on replay or backfill, harmless. The migrations shape the
+// trades table of the postgres db and never run against QuestDB.
+func (r *trades) EnsureTable(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS trades (
+			timestamp TIMESTAMP,
+			exchange SYMBOL,
+			symbol SYMBOL,
+			side SYMBOL,
+			price DOUBLE,
+			quantity DOUBLE,
+			quote_volume DOUBLE,
+			key VARCHAR
+		) TIMESTAMP(timestamp) PARTITION BY DAY WAL
+		DEDUP UPSERT KEYS(timestamp, exchange, key)
+	`)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("trades", "EnsureTable").Inc()
+		return fmt.Errorf("[repository][ilp][trades][EnsureTable][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// InsertMany streams trades in chunks of rowsPerSend rows, each with the
+// trade time as designated timestamp. ILP does not report which rows were
+// deduplicated, so every trade sent is returned as stored.
+func (r *trades) InsertMany(ctx context.Context, trades []entity.TradeActivityV2) ([]entity.TradeActivityV2, error) {
+	var buf lineBuffer
+
+	for i, trade := range trades {
+		buf.table("trades").
+			symbol("exchange", trade.Exchange).
+			symbol("symbol", trade.Symbol).
+			symbol("side", string(trade.Side)).
+			decimalColumn("price", trade.Price).
+			decimalColumn("quantity", trade.BaseVolume).
+			decimalColumn("quote_volume", trade.QuoteVolume).
+			stringColumn("key", trade.Key).
+			at(trade.Epoch)
+
+		if buf.len() < r.rowsPerSend && i < len(trades)-1 {
+			continue
+		}
+
+		err := r.sender.send(ctx, buf.bytes())
+		if err != nil {
+			metrics.DbErrors.WithLabelValues("trades", "InsertMany").Inc()
+			// the chunks sent before are stored
+			return trades[:i+1-buf.len()], fmt.Errorf("[repository][ilp][trades][InsertMany][sender.send] %w", err)
+		}
+
+		buf.reset()
+	}
+
+	return trades, nil
+}
+
+func (r *trades) GetMany(ctx context.Context, query entity.TradesQuery) ([]entity.TradeActivityV2, error) {
+	return r.reader.GetMany(ctx, query)
+}
@@ -7,11 +7,22 @@ import (
 )
 
 type Trades interface {
-	InsertMany(ctx context.Context, trades []entity.TradeActivityV2) error
+	// InsertMany returns the trades it stored, leaving out those already
+	// stored when the repository can tell. On error it still returns those
+	// stored before the failure, if any.
+	InsertMany(ctx context.Context, trades []entity.TradeActivityV2) ([]entity.TradeActivityV2, error)
+	GetMany(ctx context.Context, query entity.TradesQuery) ([]entity.TradeActivityV2, error)
 }
 
-type Candles1m interface {
-	InsertOne(ctx context.Context, candle entity.Candle) error
-	GetOne(ctx context.Context, timestamp time.Time, exchange, symbol string) (*entity.Candle, error)
-	UpdateOne(ctx context.Context, candle entity.Candle) error
+// Candles stores candles per resolution; size 1m holds the candles built from
+// trades and larger sizes hold rollups derived from them.
+type Candles interface {
+	EnsureTable(ctx context.Context, size time.Duration) error
+	UpsertMany(ctx context.Context, size time.Duration, candles []entity.Candle) error
+	GetRange(ctx context.Context, size time.Duration, exchange, symbol string, from, to time.Time, limit int) ([]entity.Candle, error)
+}
+
+type PairMeta interface {
+	UpsertMany(ctx context.Context, metas []entity.PairMeta) error
+	GetAll(ctx context.Context) ([]entity.PairMeta, error)
 }
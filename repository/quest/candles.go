@@ -0,0 +1,218 @@
+package quest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/common"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/metrics"
+	"strings"
+	"time"
+)
+
+// candlesPerStatement keeps a statement well under the 65535 bind parameter
+// limit at 12 parameters per candle.
+const candlesPerStatement = 5000
+
+type candles struct {
+	db *sql.DB
+}
+
+func NewCandles(db *sql.DB) *candles {
+	return &candles{
+		db: db,
+	}
+}
+
+// candlesTable maps a resolution to its table, e.g. 1m to candles_1m and 4h
+// to candles_4h.
+func candlesTable(size time.Duration) (string, error) {
+	if size < time.Minute || size%time.Minute != 0 {
+		return "", fmt.Errorf("invalid candle size: %s", size.String())
+	}
+
+	return "candles_" + common.FormatInterval(size), nil
+}
+
+// EnsureTable creates the table for a resolution shaped like candles_1m,
+// including its unique (exchange, symbol, timestamp) index.
+func (r *candles) EnsureTable(ctx context.Context, size time.Duration) error {
+	table, err := candlesTable(size)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][candles][EnsureTable][candlesTable] %w", err)
+	}
+
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (LIKE candles_1m INCLUDING ALL)`, table)
+
+	_, err = r.db.ExecContext(ctx, q)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("candles", "EnsureTable").Inc()
+		return fmt.Errorf("[repository][quest][candles][EnsureTable][db.ExecContext] error: %w", err)
+	}
+
+	// tables created before candles_1m had open_at and close_at lack them
+	for _, column := range []string{"open_at", "close_at"} {
+		q = fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s TIMESTAMPTZ`, table, column)
+
+		_, err = r.db.ExecContext(ctx, q)
+		if err != nil {
+			metrics.DbErrors.WithLabelValues("candles", "EnsureTable").Inc()
+			return fmt.Errorf("[repository][quest][candles][EnsureTable][db.ExecContext] add %s: %w", column, err)
+		}
+	}
+
+	return nil
+}
+
+// UpsertMany merges candles into existing rows of the same bucket, keeping
+// the open of the earliest trade, widening high/low, keeping the close of the
+// latest trade and summing volumes, so batches may come in any order.
+func (r *candles) UpsertMany(ctx context.Context, size time.Duration, candles []entity.Candle) error {
+	table, err := candlesTable(size)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][candles][UpsertMany][candlesTable] %w", err)
+	}
+
+	for start := 0; start < len(candles); start += candlesPerStatement {
+		end := min(start+candlesPerStatement, len(candles))
+
+		err := r.upsertChunk(ctx, table, candles[start:end])
+		if err != nil {
+			return fmt.Errorf("[repository][quest][candles][UpsertMany][upsertChunk] %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *candles) upsertChunk(ctx context.Context, table string, candles []entity.Candle) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `
+		INSERT INTO %s AS c
+		(timestamp, exchange, symbol, open, high, low, close, volume, buy_volume, sell_volume, open_at, close_at)
+		VALUES `, table)
+
+	vals := make([]any, 0, len(candles)*12)
+	for i, candle := range candles {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*12+1, i*12+2, i*12+3, i*12+4, i*12+5, i*12+6, i*12+7, i*12+8, i*12+9, i*12+10, i*12+11, i*12+12)
+
+		vals = append(vals,
+			time.Unix(candle.Epoch, 0),
+			candle.Exchange,
+			candle.Symbol,
+			candle.Open,
+			candle.High,
+			candle.Low,
+			candle.Close,
+			candle.Volume.Total,
+			candle.Volume.Buy,
+			candle.Volume.Sell,
+			time.Unix(candle.OpenEpoch, 0),
+			time.Unix(candle.CloseEpoch, 0),
+		)
+	}
+
+	// rows written before open_at and close_at existed have them NULL, keep
+	// their open and take the new close
+	sb.WriteString(`
+		ON CONFLICT (exchange, symbol, timestamp) DO UPDATE SET
+			open = CASE
+				WHEN c.open_at IS NOT NULL AND EXCLUDED.open_at < c.open_at THEN EXCLUDED.open
+				ELSE c.open
+			END,
+			open_at = LEAST(c.open_at, EXCLUDED.open_at),
+			high = GREATEST(c.high, EXCLUDED.high),
+			low = LEAST(c.low, EXCLUDED.low),
+			close = CASE
+				WHEN c.close_at IS NULL OR EXCLUDED.close_at >= c.close_at THEN EXCLUDED.close
+				ELSE c.close
+			END,
+			close_at = GREATEST(c.close_at, EXCLUDED.close_at),
+			volume = c.volume + EXCLUDED.volume,
+			buy_volume = c.buy_volume + EXCLUDED.buy_volume,
+			sell_volume = c.sell_volume + EXCLUDED.sell_volume
+	`)
+
+	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("candles", "UpsertMany").Inc()
+		return fmt.Errorf("[repository][quest][candles][upsertChunk][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *candles) GetRange(ctx context.Context, size time.Duration, exchange, symbol string, from, to time.Time, limit int) ([]entity.Candle, error) {
+	table, err := candlesTable(size)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][quest][candles][GetRange][candlesTable] %w", err)
+	}
+
+	q := fmt.Sprintf(`
+		SELECT timestamp, exchange, symbol, open, high, low, close, volume, buy_volume, sell_volume, open_at, close_at
+		FROM %s
+		WHERE exchange = $1
+			AND symbol = $2
+			AND timestamp >= $3
+			AND timestamp < $4
+		ORDER BY timestamp ASC
+		LIMIT $5
+	`, table)
+
+	rows, err := r.db.QueryContext(ctx, q, exchange, symbol, from, to, limit)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("candles", "GetRange").Inc()
+		return nil, fmt.Errorf("[repository][quest][candles][GetRange][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	candles := []entity.Candle{}
+
+	for rows.Next() {
+		var candle entity.Candle
+		var candleTs time.Time
+		var openAt, closeAt sql.NullTime
+
+		err := rows.Scan(
+			&candleTs,
+			&candle.Exchange,
+			&candle.Symbol,
+			&candle.Open,
+			&candle.High,
+			&candle.Low,
+			&candle.Close,
+			&candle.Volume.Total,
+			&candle.Volume.Buy,
+			&candle.Volume.Sell,
+			&openAt,
+			&closeAt,
+		)
+		if err != nil {
+			metrics.DbErrors.WithLabelValues("candles", "GetRange").Inc()
+			return nil, fmt.Errorf("[repository][quest][candles][GetRange][rows.Scan] error: %w", err)
+		}
+
+		candle.Epoch = candleTs.Unix()
+		if openAt.Valid {
+			candle.OpenEpoch = openAt.Time.Unix()
+		}
+		if closeAt.Valid {
+			candle.CloseEpoch = closeAt.Time.Unix()
+		}
+
+		candles = append(candles, candle)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("candles", "GetRange").Inc()
+		return nil, fmt.Errorf("[repository][quest][candles][GetRange][rows.Err] error: %w", err)
+	}
+
+	return candles, nil
+}
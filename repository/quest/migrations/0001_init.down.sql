@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS candles_1m;
+
+DROP TABLE IF EXISTS trades;
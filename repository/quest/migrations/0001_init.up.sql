@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS trades (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    price DOUBLE PRECISION NOT NULL,
+    quantity DOUBLE PRECISION NOT NULL,
+    side TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS candles_1m (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open DOUBLE PRECISION NOT NULL,
+    high DOUBLE PRECISION NOT NULL,
+    low DOUBLE PRECISION NOT NULL,
+    close DOUBLE PRECISION NOT NULL,
+    volume DOUBLE PRECISION NOT NULL,
+    buy_volume DOUBLE PRECISION NOT NULL,
+    sell_volume DOUBLE PRECISION NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS trades_exchange_key_idx;
+
+ALTER TABLE trades
+    DROP COLUMN IF EXISTS key,
+    DROP COLUMN IF EXISTS quote_volume;
@@ -0,0 +1,5 @@
+ALTER TABLE trades
+    ADD COLUMN IF NOT EXISTS quote_volume DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS trades_exchange_key_idx ON trades (exchange, key);
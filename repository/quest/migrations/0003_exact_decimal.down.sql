@@ -0,0 +1,13 @@
+ALTER TABLE trades
+    ALTER COLUMN price TYPE DOUBLE PRECISION USING price::DOUBLE PRECISION,
+    ALTER COLUMN quantity TYPE DOUBLE PRECISION USING quantity::DOUBLE PRECISION,
+    ALTER COLUMN quote_volume TYPE DOUBLE PRECISION USING quote_volume::DOUBLE PRECISION;
+
+ALTER TABLE candles_1m
+    ALTER COLUMN open TYPE DOUBLE PRECISION USING open::DOUBLE PRECISION,
+    ALTER COLUMN high TYPE DOUBLE PRECISION USING high::DOUBLE PRECISION,
+    ALTER COLUMN low TYPE DOUBLE PRECISION USING low::DOUBLE PRECISION,
+    ALTER COLUMN close TYPE DOUBLE PRECISION USING close::DOUBLE PRECISION,
+    ALTER COLUMN volume TYPE DOUBLE PRECISION USING volume::DOUBLE PRECISION,
+    ALTER COLUMN buy_volume TYPE DOUBLE PRECISION USING buy_volume::DOUBLE PRECISION,
+    ALTER COLUMN sell_volume TYPE DOUBLE PRECISION USING sell_volume::DOUBLE PRECISION;
@@ -0,0 +1,16 @@
+-- Values already stored as floats keep whatever precision they had; only new
+-- writes are exact.
+
+ALTER TABLE trades
+    ALTER COLUMN price TYPE NUMERIC USING price::NUMERIC,
+    ALTER COLUMN quantity TYPE NUMERIC USING quantity::NUMERIC,
+    ALTER COLUMN quote_volume TYPE NUMERIC USING quote_volume::NUMERIC;
+
+ALTER TABLE candles_1m
+    ALTER COLUMN open TYPE NUMERIC USING open::NUMERIC,
+    ALTER COLUMN high TYPE NUMERIC USING high::NUMERIC,
+    ALTER COLUMN low TYPE NUMERIC USING low::NUMERIC,
+    ALTER COLUMN close TYPE NUMERIC USING close::NUMERIC,
+    ALTER COLUMN volume TYPE NUMERIC USING volume::NUMERIC,
+    ALTER COLUMN buy_volume TYPE NUMERIC USING buy_volume::NUMERIC,
+    ALTER COLUMN sell_volume TYPE NUMERIC USING sell_volume::NUMERIC;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS candles_1m_exchange_symbol_timestamp_idx;
+
+DROP INDEX IF EXISTS trades_exchange_symbol_timestamp_idx;
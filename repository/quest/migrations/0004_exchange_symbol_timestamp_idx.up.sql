@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS trades_exchange_symbol_timestamp_idx ON trades (exchange, symbol, timestamp);
+
+CREATE INDEX IF NOT EXISTS candles_1m_exchange_symbol_timestamp_idx ON candles_1m (exchange, symbol, timestamp);
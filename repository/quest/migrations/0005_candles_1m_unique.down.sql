@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS candles_1m_exchange_symbol_timestamp_key;
+
+CREATE INDEX IF NOT EXISTS candles_1m_exchange_symbol_timestamp_idx ON candles_1m (exchange, symbol, timestamp);
@@ -0,0 +1,12 @@
+-- Collapse duplicate minutes left by the old read-then-write path before
+-- enforcing uniqueness, keeping the most recently written row.
+DELETE FROM candles_1m a
+USING candles_1m b
+WHERE a.exchange = b.exchange
+    AND a.symbol = b.symbol
+    AND a.timestamp = b.timestamp
+    AND a.ctid < b.ctid;
+
+DROP INDEX IF EXISTS candles_1m_exchange_symbol_timestamp_idx;
+
+CREATE UNIQUE INDEX IF NOT EXISTS candles_1m_exchange_symbol_timestamp_key ON candles_1m (exchange, symbol, timestamp);
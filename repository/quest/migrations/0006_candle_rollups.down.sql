@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS candles_1d;
+
+DROP TABLE IF EXISTS candles_4h;
+
+DROP TABLE IF EXISTS candles_1h;
+
+DROP TABLE IF EXISTS candles_15m;
+
+DROP TABLE IF EXISTS candles_5m;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS candles_5m (LIKE candles_1m INCLUDING ALL);
+
+CREATE TABLE IF NOT EXISTS candles_15m (LIKE candles_1m INCLUDING ALL);
+
+CREATE TABLE IF NOT EXISTS candles_1h (LIKE candles_1m INCLUDING ALL);
+
+CREATE TABLE IF NOT EXISTS candles_4h (LIKE candles_1m INCLUDING ALL);
+
+CREATE TABLE IF NOT EXISTS candles_1d (LIKE candles_1m INCLUDING ALL);
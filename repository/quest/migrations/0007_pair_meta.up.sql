@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS pair_meta (
+    exchange TEXT NOT NULL,
+    id TEXT NOT NULL,
+    base_currency TEXT NOT NULL,
+    traded_currency TEXT NOT NULL,
+    price_precision NUMERIC NOT NULL,
+    volume_precision NUMERIC NOT NULL,
+    min_base_trade NUMERIC NOT NULL,
+    is_suspended BOOLEAN NOT NULL,
+    is_maintenance BOOLEAN NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (exchange, id)
+);
@@ -0,0 +1,11 @@
+ALTER TABLE candles_1d DROP COLUMN IF EXISTS close_at;
+
+ALTER TABLE candles_4h DROP COLUMN IF EXISTS close_at;
+
+ALTER TABLE candles_1h DROP COLUMN IF EXISTS close_at;
+
+ALTER TABLE candles_15m DROP COLUMN IF EXISTS close_at;
+
+ALTER TABLE candles_5m DROP COLUMN IF EXISTS close_at;
+
+ALTER TABLE candles_1m DROP COLUMN IF EXISTS close_at;
@@ -0,0 +1,14 @@
+-- Records when the trade setting each close happened, so merging an older
+-- batch into a candle no longer overwrites a later close.
+
+ALTER TABLE candles_1m ADD COLUMN IF NOT EXISTS close_at TIMESTAMPTZ;
+
+ALTER TABLE candles_5m ADD COLUMN IF NOT EXISTS close_at TIMESTAMPTZ;
+
+ALTER TABLE candles_15m ADD COLUMN IF NOT EXISTS close_at TIMESTAMPTZ;
+
+ALTER TABLE candles_1h ADD COLUMN IF NOT EXISTS close_at TIMESTAMPTZ;
+
+ALTER TABLE candles_4h ADD COLUMN IF NOT EXISTS close_at TIMESTAMPTZ;
+
+ALTER TABLE candles_1d ADD COLUMN IF NOT EXISTS close_at TIMESTAMPTZ;
@@ -0,0 +1,14 @@
+-- Records when the trade setting each open happened, so merging a later
+-- batch into a candle no longer keeps an open written first but traded later.
+
+ALTER TABLE candles_1m ADD COLUMN IF NOT EXISTS open_at TIMESTAMPTZ;
+
+ALTER TABLE candles_5m ADD COLUMN IF NOT EXISTS open_at TIMESTAMPTZ;
+
+ALTER TABLE candles_15m ADD COLUMN IF NOT EXISTS open_at TIMESTAMPTZ;
+
+ALTER TABLE candles_1h ADD COLUMN IF NOT EXISTS open_at TIMESTAMPTZ;
+
+ALTER TABLE candles_4h ADD COLUMN IF NOT EXISTS open_at TIMESTAMPTZ;
+
+ALTER TABLE candles_1d ADD COLUMN IF NOT EXISTS open_at TIMESTAMPTZ;
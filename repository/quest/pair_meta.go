@@ -0,0 +1,125 @@
+package quest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/metrics"
+	"strings"
+	"time"
+)
+
+// pairMetasPerStatement keeps a statement well under the 65535 bind parameter
+// limit at 10 parameters per pair.
+const pairMetasPerStatement = 5000
+
+type pairMeta struct {
+	db *sql.DB
+}
+
+func NewPairMeta(db *sql.DB) *pairMeta {
+	return &pairMeta{
+		db: db,
+	}
+}
+
+// UpsertMany replaces the stored metadata of every given pair, in chunks of
+// pairMetasPerStatement pairs.
+func (r *pairMeta) UpsertMany(ctx context.Context, metas []entity.PairMeta) error {
+	for start := 0; start < len(metas); start += pairMetasPerStatement {
+		end := min(start+pairMetasPerStatement, len(metas))
+
+		err := r.upsertChunk(ctx, metas[start:end])
+		if err != nil {
+			return fmt.Errorf("[repository][quest][pairMeta][UpsertMany][upsertChunk] %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *pairMeta) upsertChunk(ctx context.Context, metas []entity.PairMeta) error {
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO pair_meta (exchange, id, base_currency, traded_currency, price_precision, volume_precision, min_base_trade, is_suspended, is_maintenance, updated_at) VALUES `)
+
+	vals := make([]any, 0, len(metas)*10)
+	for i, meta := range metas {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*10+1, i*10+2, i*10+3, i*10+4, i*10+5, i*10+6, i*10+7, i*10+8, i*10+9, i*10+10)
+
+		vals = append(vals, meta.Exchange, meta.ID, meta.BaseCurrency, meta.TradedCurrency, meta.PricePrecision, meta.VolumePrecision, meta.MinBaseTrade, meta.IsSuspended, meta.IsMaintenance, time.Unix(meta.UpdatedAt, 0))
+	}
+
+	sb.WriteString(`
+		ON CONFLICT (exchange, id) DO UPDATE SET
+			base_currency = EXCLUDED.base_currency,
+			traded_currency = EXCLUDED.traded_currency,
+			price_precision = EXCLUDED.price_precision,
+			volume_precision = EXCLUDED.volume_precision,
+			min_base_trade = EXCLUDED.min_base_trade,
+			is_suspended = EXCLUDED.is_suspended,
+			is_maintenance = EXCLUDED.is_maintenance,
+			updated_at = EXCLUDED.updated_at`)
+
+	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("pairMeta", "UpsertMany").Inc()
+		return fmt.Errorf("[repository][quest][pairMeta][upsertChunk][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *pairMeta) GetAll(ctx context.Context) ([]entity.PairMeta, error) {
+	q := `
+		SELECT exchange, id, base_currency, traded_currency, price_precision, volume_precision, min_base_trade, is_suspended, is_maintenance, updated_at
+		FROM pair_meta
+		ORDER BY exchange ASC, id ASC`
+
+	rows, err := r.db.QueryContext(ctx, q)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("pairMeta", "GetAll").Inc()
+		return nil, fmt.Errorf("[repository][quest][pairMeta][GetAll][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	metas := []entity.PairMeta{}
+
+	for rows.Next() {
+		var meta entity.PairMeta
+		var updatedAt time.Time
+
+		err := rows.Scan(
+			&meta.Exchange,
+			&meta.ID,
+			&meta.BaseCurrency,
+			&meta.TradedCurrency,
+			&meta.PricePrecision,
+			&meta.VolumePrecision,
+			&meta.MinBaseTrade,
+			&meta.IsSuspended,
+			&meta.IsMaintenance,
+			&updatedAt,
+		)
+		if err != nil {
+			metrics.DbErrors.WithLabelValues("pairMeta", "GetAll").Inc()
+			return nil, fmt.Errorf("[repository][quest][pairMeta][GetAll][rows.Scan] error: %w", err)
+		}
+
+		meta.UpdatedAt = updatedAt.Unix()
+
+		metas = append(metas, meta)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("pairMeta", "GetAll").Inc()
+		return nil, fmt.Errorf("[repository][quest][pairMeta][GetAll][rows.Err] error: %w", err)
+	}
+
+	return metas, nil
+}
@@ -5,42 +5,232 @@ import (
 	"database/sql"
 	"fmt"
 	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/metrics"
 	"strings"
 	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	paramsPerTrade = 8
+	// maxTradesPerStatement keeps a statement under the 65535 bind parameter
+	// limit.
+	maxTradesPerStatement = 65535 / paramsPerTrade
 )
 
+type TradesOpt struct {
+	// ChunkSize caps the trades per INSERT statement, defaulting to and
+	// capped at what fits the bind parameter limit
+	ChunkSize int
+	// Transactional writes every chunk of a batch in one transaction, so a
+	// batch is stored whole or not at all
+	Transactional bool
+}
+
 type trades struct {
-	db *sql.DB
+	db            *sql.DB
+	chunkSize     int
+	transactional bool
 }
 
-func NewTrades(db *sql.DB) *trades {
+func NewTrades(db *sql.DB, opt TradesOpt) *trades {
+	if opt.ChunkSize <= 0 || opt.ChunkSize > maxTradesPerStatement {
+		opt.ChunkSize = maxTradesPerStatement
+	}
+
 	return &trades{
-		db: db,
+		db:            db,
+		chunkSize:     opt.ChunkSize,
+		transactional: opt.Transactional,
+	}
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// InsertMany skips trades already stored, relying on a unique index on
+// trades (exchange, key), and returns the trades it did insert. Trades are
+// inserted in chunks of chunkSize; without a transaction the chunks before a
+// failed one stay stored and are returned along with the error, as a retry
+// skips them and would never report them inserted.
+func (r *trades) InsertMany(ctx context.Context, trades []entity.TradeActivityV2) ([]entity.TradeActivityV2, error) {
+	if len(trades) == 0 {
+		return nil, nil
+	}
+
+	if !r.transactional {
+		return r.insertChunks(ctx, r.db, trades)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("trades", "InsertMany").Inc()
+		return nil, fmt.Errorf("[repository][quest][trades][InsertMany][db.BeginTx] error: %w", err)
 	}
+	defer tx.Rollback()
+
+	// rolled back, nothing of the batch is stored
+	inserted, err := r.insertChunks(ctx, tx, trades)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("trades", "InsertMany").Inc()
+		return nil, fmt.Errorf("[repository][quest][trades][InsertMany][tx.Commit] error: %w", err)
+	}
+
+	return inserted, nil
 }
 
-func (r *trades) InsertMany(ctx context.Context, trades []entity.TradeActivityV2) error {
+func (r *trades) insertChunks(ctx context.Context, db querier, trades []entity.TradeActivityV2) ([]entity.TradeActivityV2, error) {
+	inserted := []entity.TradeActivityV2{}
+
+	for start := 0; start < len(trades); start += r.chunkSize {
+		end := min(start+r.chunkSize, len(trades))
+
+		chunk, err := insertChunk(ctx, db, trades[start:end])
+		if err != nil {
+			return inserted, fmt.Errorf("[repository][quest][trades][InsertMany][insertChunk] trades %d to %d of %d: %w", start, end, len(trades), err)
+		}
+
+		inserted = append(inserted, chunk...)
+	}
+
+	return inserted, nil
+}
+
+func insertChunk(ctx context.Context, db querier, trades []entity.TradeActivityV2) ([]entity.TradeActivityV2, error) {
 	var sb strings.Builder
-	sb.WriteString("INSERT INTO trades (timestamp, exchange, symbol, price, quantity, side) VALUES ")
+	sb.WriteString("INSERT INTO trades (timestamp, exchange, symbol, price, quantity, quote_volume, side, key) VALUES ")
 
-	vals := make([]any, 0, len(trades)*6)
+	vals := make([]any, 0, len(trades)*paramsPerTrade)
 	for i, trade := range trades {
 		if i > 0 {
 			sb.WriteString(",")
 		}
 
-		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d)", i*6+1, i*6+2, i*6+3, i*6+4, i*6+5, i*6+6)
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*8+1, i*8+2, i*8+3, i*8+4, i*8+5, i*8+6, i*8+7, i*8+8)
+
+		vals = append(vals, time.Unix(trade.Epoch, 0), trade.Exchange, trade.Symbol, trade.Price, trade.BaseVolume, trade.QuoteVolume, trade.Side, trade.Key)
+	}
+
+	sb.WriteString(" ON CONFLICT (exchange, key) DO NOTHING RETURNING exchange, key")
+
+	rows, err := db.QueryContext(ctx, sb.String(), vals...)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("trades", "InsertMany").Inc()
+		return nil, fmt.Errorf("[repository][quest][trades][insertChunk][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	insertedKeys := map[string]bool{}
+
+	for rows.Next() {
+		var exchange, key string
+
+		err := rows.Scan(&exchange, &key)
+		if err != nil {
+			metrics.DbErrors.WithLabelValues("trades", "InsertMany").Inc()
+			return nil, fmt.Errorf("[repository][quest][trades][insertChunk][rows.Scan] error: %w", err)
+		}
+
+		insertedKeys[exchange+":"+key] = true
+	}
+
+	err = rows.Err()
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("trades", "InsertMany").Inc()
+		return nil, fmt.Errorf("[repository][quest][trades][insertChunk][rows.Err] error: %w", err)
+	}
+
+	inserted := make([]entity.TradeActivityV2, 0, len(insertedKeys))
+	for _, trade := range trades {
+		if insertedKeys[trade.Exchange+":"+trade.Key] {
+			inserted = append(inserted, trade)
+		}
+	}
+
+	return inserted, nil
+}
+
+func (r *trades) GetMany(ctx context.Context, query entity.TradesQuery) ([]entity.TradeActivityV2, error) {
+	var sb strings.Builder
+	sb.WriteString(`
+		SELECT timestamp, exchange, symbol, price, quantity, quote_volume, side, key
+		FROM trades
+		WHERE exchange = $1
+			AND symbol = $2
+			AND timestamp >= $3
+			AND timestamp < $4`)
+
+	vals := []any{query.Exchange, query.Symbol, query.From, query.To}
+
+	if query.Side != "" {
+		vals = append(vals, query.Side)
+		fmt.Fprintf(&sb, `
+			AND side = $%d`, len(vals))
+	}
+
+	if query.AfterEpoch != 0 {
+		vals = append(vals, time.Unix(query.AfterEpoch, 0), query.AfterKey)
+		fmt.Fprintf(&sb, `
+			AND (timestamp > $%d OR (timestamp = $%d AND key > $%d))`, len(vals)-1, len(vals)-1, len(vals))
+	}
+
+	vals = append(vals, query.Limit)
+	fmt.Fprintf(&sb, `
+		ORDER BY timestamp ASC, key ASC
+		LIMIT $%d`, len(vals))
 
-		priceFl, _ := trade.Price.Float64()
-		quantityFl, _ := trade.BaseVolume.Float64()
+	rows, err := r.db.QueryContext(ctx, sb.String(), vals...)
+	if err != nil {
+		metrics.DbErrors.WithLabelValues("trades", "GetMany").Inc()
+		return nil, fmt.Errorf("[repository][quest][trades][GetMany][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	trades := []entity.TradeActivityV2{}
+
+	for rows.Next() {
+		var trade entity.TradeActivityV2
+		var tradeTs time.Time
+		var quoteVolume decimal.NullDecimal
+		var key sql.NullString
+
+		err := rows.Scan(
+			&tradeTs,
+			&trade.Exchange,
+			&trade.Symbol,
+			&trade.Price,
+			&trade.BaseVolume,
+			&quoteVolume,
+			&trade.Side,
+			&key,
+		)
+		if err != nil {
+			metrics.DbErrors.WithLabelValues("trades", "GetMany").Inc()
+			return nil, fmt.Errorf("[repository][quest][trades][GetMany][rows.Scan] error: %w", err)
+		}
+
+		trade.Epoch = tradeTs.Unix()
+		trade.QuoteVolume = quoteVolume.Decimal
+		if !quoteVolume.Valid {
+			trade.QuoteVolume = trade.Price.Mul(trade.BaseVolume)
+		}
+		trade.Key = key.String
 
-		vals = append(vals, time.Unix(trade.Epoch, 0), trade.Exchange, trade.Symbol, priceFl, quantityFl, trade.Side)
+		trades = append(trades, trade)
 	}
 
-	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	err = rows.Err()
 	if err != nil {
-		return fmt.Errorf("[repository][quest][trades][InsertMany][db.ExecContext] error: %w", err)
+		metrics.DbErrors.WithLabelValues("trades", "GetMany").Inc()
+		return nil, fmt.Errorf("[repository][quest][trades][GetMany][rows.Err] error: %w", err)
 	}
 
-	return nil
+	return trades, nil
 }
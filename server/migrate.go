@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"io/fs"
+	"michaelyusak/go-market-ingestor.git/config"
+	"michaelyusak/go-market-ingestor.git/migration"
+	"michaelyusak/go-market-ingestor.git/repository/quest"
+	"strconv"
+
+	hAdaptor "github.com/michaelyusak/go-helper/adaptor"
+	"github.com/sirupsen/logrus"
+)
+
+func migrationsFS() fs.FS {
+	fsys, err := fs.Sub(quest.Migrations, "migrations")
+	if err != nil {
+		logrus.Panicf("Failed to open embedded migrations: %v", err)
+	}
+
+	return fsys
+}
+
+// Migrate runs the migrate subcommand: `migrate up` or `migrate down [steps]`.
+func Migrate(args []string) {
+	conf, err := config.Init()
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	db, err := hAdaptor.ConnectDB(hAdaptor.PSQL, conf.Service.Db)
+	if err != nil {
+		logrus.Panicf("Failed to connect to db: %v", err)
+	}
+	defer db.Close()
+
+	migrator := migration.NewMigrator(db, migrationsFS())
+	ctx := context.Background()
+
+	direction := "up"
+	if len(args) > 0 {
+		direction = args[0]
+	}
+
+	switch direction {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			logrus.Fatalf("Failed to migrate up: %v", err)
+		}
+
+		logrus.WithField("applied", applied).Info("Migrated up")
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				logrus.Fatalf("Invalid steps: %s", args[1])
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			logrus.Fatalf("Failed to migrate down: %v", err)
+		}
+
+		logrus.WithField("reverted", reverted).Info("Migrated down")
+	default:
+		logrus.Fatalf("Unknown migrate direction: %s", direction)
+	}
+}
@@ -1,13 +1,23 @@
 package server
 
 import (
+	"context"
+	"database/sql"
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
 	"michaelyusak/go-market-ingestor.git/adapter/exchange/binance"
 	"michaelyusak/go-market-ingestor.git/adapter/exchange/indodax"
+	"michaelyusak/go-market-ingestor.git/bus"
+	"michaelyusak/go-market-ingestor.git/common"
 	"michaelyusak/go-market-ingestor.git/config"
 	"michaelyusak/go-market-ingestor.git/entity"
 	"michaelyusak/go-market-ingestor.git/handler"
+	"michaelyusak/go-market-ingestor.git/metrics"
+	"michaelyusak/go-market-ingestor.git/middleware"
+	"michaelyusak/go-market-ingestor.git/repository"
+	"michaelyusak/go-market-ingestor.git/repository/ilp"
 	"michaelyusak/go-market-ingestor.git/repository/quest"
 	"michaelyusak/go-market-ingestor.git/service"
+	"michaelyusak/go-market-ingestor.git/spool"
 	"net/http"
 	"time"
 
@@ -15,30 +25,91 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	hAdaptor "github.com/michaelyusak/go-helper/adaptor"
+	hEntity "github.com/michaelyusak/go-helper/entity"
 	hHandler "github.com/michaelyusak/go-helper/handler"
 	hMiddleware "github.com/michaelyusak/go-helper/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 )
 
 type routerOpts struct {
 	handler struct {
-		common *hHandler.Common
-		stream *handler.Stream
+		common    *hHandler.Common
+		health    *handler.Health
+		stream    *handler.Stream
+		candle    *handler.Candle
+		trade     *handler.Trade
+		gap       *handler.Gap
+		pair      *handler.Pair
+		listener  *handler.Listener
+		orderBook *handler.OrderBook
 	}
 }
 
-func newRouter(config *config.AppConfig) *gin.Engine {
-	db, err := hAdaptor.ConnectDB(hAdaptor.PSQL, config.Service.Db)
+// app holds the router and what has to be stopped, in order, on shutdown.
+type app struct {
+	router         *gin.Engine
+	exchanges      map[string]exchange.Exchage
+	storageService service.Storage
+	streamHandler  *handler.Stream
+	closeStorage   func() // closes what the writer opened besides db
+}
+
+// newApp wires the app and starts listening to the exchanges until ctx is
+// done.
+func newApp(ctx context.Context, config *config.AppConfig, db *sql.DB) app {
+	eventBus := bus.New()
+	metrics.RegisterBus(eventBus)
+
+	tradeActivityTopic := bus.NewTopic[entity.TradeActivityV2](eventBus, "trade_activity")
+	tradeBackfillTopic := bus.NewTopic[entity.TradeActivityV2](eventBus, "trade_backfill")
+	orderBookTopic := bus.NewTopic[entity.OrderBook](eventBus, "order_book")
+
+	tradeActivityStreamSub, err := tradeActivityTopic.Subscribe(newSubscriberOpt("stream", config.Bus.Stream))
+	if err != nil {
+		logrus.Panicf("Failed to subscribe stream to trade activity: %v", err)
+	}
+
+	storageSubOpt := newSubscriberOpt("storage", config.Bus.Storage)
+	if config.Bus.Storage.BufferSize <= 0 {
+		storageSubOpt.BufferSize = 10000
+	}
+	if config.Bus.Storage.OverflowPolicy == "" {
+		// trades are meant for the database, they wait for storage instead of
+		// being dropped, briefly so the exchange readers do not stall
+		storageSubOpt.Policy = bus.OverflowBlock
+		if storageSubOpt.BlockTimeout <= 0 {
+			storageSubOpt.BlockTimeout = 5 * time.Second
+		}
+	}
+
+	tradeActivityStorageSub, err := tradeActivityTopic.Subscribe(storageSubOpt)
 	if err != nil {
-		logrus.Panicf("Failed to connect to db: %v", err)
+		logrus.Panicf("Failed to subscribe storage to trade activity: %v", err)
 	}
-	logrus.Info("Connected to postgres")
 
-	tradeActivityStreamCh := make(chan entity.TradeActivityV2, 50)
+	orderBookSubOpt := newSubscriberOpt("order_book", config.Bus.OrderBook)
+	if config.Bus.OrderBook.OverflowPolicy == "" {
+		// only the latest book of a symbol is kept
+		orderBookSubOpt.Policy = bus.OverflowDropOldest
+	}
 
-	tradeActivityStorageCh := make(chan entity.TradeActivityV2, 50)
+	orderBookSub, err := orderBookTopic.Subscribe(orderBookSubOpt)
+	if err != nil {
+		logrus.Panicf("Failed to subscribe order book snapshots to order book: %v", err)
+	}
 
-	tradeActivityCh := []chan entity.TradeActivityV2{tradeActivityStreamCh, tradeActivityStorageCh}
+	// backfills come in bursts and are not latency sensitive, so they wait
+	// for storage instead of being dropped
+	tradeBackfillStorageSub, err := tradeBackfillTopic.Subscribe(bus.SubscriberOpt{
+		Name:         "storage",
+		BufferSize:   1000,
+		Policy:       bus.OverflowBlock,
+		BlockTimeout: time.Minute,
+	})
+	if err != nil {
+		logrus.Panicf("Failed to subscribe storage to trade backfill: %v", err)
+	}
 
 	indodax := indodax.NewClient(
 		config.Exchange.Indodax.BaseUrl,
@@ -49,11 +120,19 @@ func newRouter(config *config.AppConfig) *gin.Engine {
 		config.Exchange.Indodax.OrderbookWsChannelPrefix,
 		config.Exchange.Indodax.TradeActivityWsChannelPrefix,
 		time.Duration(config.Exchange.Indodax.Timeout),
-		tradeActivityCh,
+		tradeActivityTopic,
+		tradeBackfillTopic,
+		orderBookTopic,
+		newSupervisorOpt(config.Exchange.Indodax.Reconnect),
 	)
 
 	binance := binance.NewClient(
-		tradeActivityCh,
+		tradeActivityTopic,
+		tradeBackfillTopic,
+		orderBookTopic,
+		config.Exchange.Binance.DepthMode,
+		config.Exchange.Binance.DepthLevels,
+		newSupervisorOpt(config.Exchange.Binance.Reconnect),
 	)
 
 	upgrader := websocket.Upgrader{
@@ -64,71 +143,385 @@ func newRouter(config *config.AppConfig) *gin.Engine {
 		},
 	}
 
+	tradesRepo, candlesRepo, closeStorage := newStorageRepos(config.Storage, config.Service.Db, db)
+
+	// pair metadata stays on the postgres db whatever the writer
+	pairMetaRepo := quest.NewPairMeta(db)
+
+	pairService := service.NewPair(
+		pairMetaRepo,
+		map[string]exchange.PairMetaFetcher{
+			"indodax": indodax,
+			"binance": binance,
+		},
+		time.Duration(config.PairMeta.RefreshInterval),
+	)
+	pairService.Load(context.Background())
+
+	indodaxPairsToListen := pairService.SelectTradable("indodax", enabledPairs(config.Exchange.Indodax.PairsToListen))
+	binancePairsToListen := pairService.SelectTradable("binance", enabledPairs(config.Exchange.Binance.PairsToListen))
+
 	listenedSymbols := []string{}
 
-	for pair, ok := range config.Exchange.Indodax.PairsToListen {
-		if ok {
-			listenedSymbols = append(listenedSymbols, "indodax:"+pair)
-		}
+	for _, pair := range indodaxPairsToListen {
+		listenedSymbols = append(listenedSymbols, common.ListenedSymbol("indodax", pair))
 	}
-	for pair, ok := range config.Exchange.Binance.PairsToListen {
-		if ok {
-			listenedSymbols = append(listenedSymbols, "binance:"+pair)
-		}
+	for _, pair := range binancePairsToListen {
+		listenedSymbols = append(listenedSymbols, common.ListenedSymbol("binance", pair))
 	}
 
-	tradesRepo := quest.NewTrades(db)
-	candles1mRepo := quest.NewCandles1m(db)
+	rollupSizes := newRollupSizes(config.Storage.CandleRollups)
+	for _, size := range rollupSizes {
+		err := candlesRepo.EnsureTable(context.Background(), size)
+		if err != nil {
+			logrus.Panicf("Failed to ensure candle rollup table: %v", err)
+		}
+	}
 
 	storageService := service.NewStorage(
 		tradesRepo,
-		candles1mRepo,
-		tradeActivityStorageCh,
+		candlesRepo,
+		rollupSizes,
+		tradeActivityStorageSub.C(),
+		tradeBackfillStorageSub.C(),
+		newSpoolOpt(config.Storage.Spool),
 	)
 	streamService := service.NewStream(
-		tradeActivityStreamCh,
+		tradeActivityStreamSub.C(),
 		listenedSymbols,
 	)
+	candleService := service.NewCandle(
+		candlesRepo,
+		rollupSizes,
+	)
+	tradeService := service.NewTrade(
+		tradesRepo,
+	)
+	statusService := service.NewStatus(
+		&APP_HEALTHY,
+		[]*exchange.Supervisor{
+			indodax.Supervisor(),
+			binance.Supervisor(),
+		},
+		time.Duration(config.Service.SilentThreshold),
+		config.Service.SilentDegradesOnly,
+	)
+	gapService := service.NewGap(
+		candlesRepo,
+		map[string]exchange.Backfiller{
+			"indodax": indodax,
+			"binance": binance,
+		},
+		streamService.GetListenedSymbols,
+		service.GapOpt{
+			Interval: time.Duration(config.GapRepair.Interval),
+			Lookback: time.Duration(config.GapRepair.Lookback),
+			MinGap:   time.Duration(config.GapRepair.MinGap),
+		},
+	)
+	orderBookService := service.NewOrderBook(
+		orderBookSub.C(),
+	)
+	listenerService := service.NewListener(
+		pairService,
+		streamService,
+		map[string]exchange.PairManager{
+			"indodax": indodax,
+			"binance": binance,
+		},
+	)
 
 	commonHandler := hHandler.NewCommon(&APP_HEALTHY)
+	healthHandler := handler.NewHealth(
+		statusService,
+	)
 	streamHandler := handler.NewStream(
 		streamService,
 		upgrader,
 	)
+	candleHandler := handler.NewCandle(
+		candleService,
+	)
+	tradeHandler := handler.NewTrade(
+		tradeService,
+	)
+	gapHandler := handler.NewGap(
+		gapService,
+	)
+	pairHandler := handler.NewPair(
+		pairService,
+	)
+	listenerHandler := handler.NewListener(
+		listenerService,
+	)
+	orderBookHandler := handler.NewOrderBook(
+		orderBookService,
+	)
 
-	storageService.Start()
-	streamService.Start()
+	if config.Watchdog.Enabled {
+		watchdogSubOpt := newSubscriberOpt("watchdog", config.Bus.Watchdog)
+		if config.Bus.Watchdog.OverflowPolicy == "" {
+			// only the latest trades matter to the watchdog
+			watchdogSubOpt.Policy = bus.OverflowDropOldest
+		}
 
-	indodaxPairsToListen := []string{}
-	for pair, listen := range config.Exchange.Indodax.PairsToListen {
-		if listen {
-			indodaxPairsToListen = append(indodaxPairsToListen, pair)
+		tradeActivityWatchdogSub, err := tradeActivityTopic.Subscribe(watchdogSubOpt)
+		if err != nil {
+			logrus.Panicf("Failed to subscribe watchdog to trade activity: %v", err)
 		}
-	}
-	indodax.ListenMarketDataInPartition(indodaxPairsToListen, 10)
 
-	binancePairsToListen := []string{}
-	for pair, listen := range config.Exchange.Binance.PairsToListen {
-		if listen {
-			binancePairsToListen = append(binancePairsToListen, pair)
+		maxSilence := map[string]time.Duration{}
+		for symbol, d := range config.Watchdog.MaxSilence {
+			maxSilence[symbol] = time.Duration(d)
 		}
+
+		watchdogService := service.NewWatchdog(
+			tradeActivityWatchdogSub.C(),
+			streamService,
+			map[string]exchange.Resubscriber{
+				"indodax": indodax,
+				"binance": binance,
+			},
+			service.WatchdogOpt{
+				CheckInterval:     time.Duration(config.Watchdog.CheckInterval),
+				DefaultMaxSilence: time.Duration(config.Watchdog.DefaultMaxSilence),
+				MaxSilence:        maxSilence,
+				AlertCooldown:     time.Duration(config.Watchdog.AlertCooldown),
+				WebhookUrl:        config.Watchdog.WebhookUrl,
+				WebhookTimeout:    time.Duration(config.Watchdog.WebhookTimeout),
+			},
+		)
+		watchdogService.Start()
 	}
-	binance.ListenMarketDataInPartition(binancePairsToListen, 10)
 
-	return createRouter(routerOpts{
+	storageService.Start()
+	streamService.Start()
+	gapService.Start()
+	pairService.Start()
+	orderBookService.Start()
+
+	indodax.ListenMarketDataInPartition(ctx, indodaxPairsToListen, 10)
+	binance.ListenMarketDataInPartition(ctx, binancePairsToListen, 10)
+
+	exchanges := map[string]exchange.Exchage{
+		"indodax": indodax,
+		"binance": binance,
+	}
+
+	router := createRouter(routerOpts{
 		handler: struct {
-			common *hHandler.Common
-			stream *handler.Stream
+			common    *hHandler.Common
+			health    *handler.Health
+			stream    *handler.Stream
+			candle    *handler.Candle
+			trade     *handler.Trade
+			gap       *handler.Gap
+			pair      *handler.Pair
+			listener  *handler.Listener
+			orderBook *handler.OrderBook
 		}{
-			common: commonHandler,
-			stream: streamHandler,
+			common:    commonHandler,
+			health:    healthHandler,
+			stream:    streamHandler,
+			candle:    candleHandler,
+			trade:     tradeHandler,
+			gap:       gapHandler,
+			pair:      pairHandler,
+			listener:  listenerHandler,
+			orderBook: orderBookHandler,
 		},
 	},
 		config.Cors.AllowedOrigins,
+		config.Service.AdminToken,
 	)
+
+	return app{
+		router:         router,
+		exchanges:      exchanges,
+		storageService: storageService,
+		streamHandler:  streamHandler,
+		closeStorage:   closeStorage,
+	}
+}
+
+func newSupervisorOpt(conf config.ReconnectConfig) exchange.SupervisorOpt {
+	return exchange.SupervisorOpt{
+		InitialBackoff:  time.Duration(conf.InitialBackoff),
+		MaxBackoff:      time.Duration(conf.MaxBackoff),
+		Jitter:          conf.Jitter,
+		MaxAttempts:     conf.MaxAttempts,
+		CircuitCooldown: time.Duration(conf.CircuitCooldown),
+		StableAfter:     time.Duration(conf.StableAfter),
+	}
+}
+
+func enabledPairs(pairsToListen map[string]bool) []string {
+	pairs := []string{}
+
+	for pair, listen := range pairsToListen {
+		if listen {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	return pairs
+}
+
+func newSubscriberOpt(name string, conf config.BusSubscriberConfig) bus.SubscriberOpt {
+	opt := bus.SubscriberOpt{
+		Name:         name,
+		BufferSize:   conf.BufferSize,
+		Policy:       bus.OverflowPolicy(conf.OverflowPolicy),
+		BlockTimeout: time.Duration(conf.BlockTimeout),
+	}
+
+	if opt.BufferSize <= 0 {
+		opt.BufferSize = 50
+	}
+
+	return opt
+}
+
+// newStorageRepos returns the trades and candles repositories of the
+// configured writer, and a func closing what they opened. The sql writer works
+// on db; the ilp writer connects to QuestDB on its own, as db runs the
+// postgres-only migrations and pair metadata.
+func newStorageRepos(conf config.StorageConfig, dbConf hEntity.DBConfig, db *sql.DB) (repository.Trades, repository.Candles, func()) {
+	switch conf.Writer {
+	case "", "sql":
+		tradesRepo := quest.NewTrades(db, quest.TradesOpt{
+			ChunkSize:     conf.InsertChunkSize,
+			Transactional: conf.InsertTransactional,
+		})
+
+		return tradesRepo, quest.NewCandles(db), func() {}
+	case "ilp":
+		if conf.Ilp.Db == dbConf {
+			// QuestDB would be sent the postgres migrations and upserts
+			logrus.Panic("storage.ilp.db must be the QuestDB instance, not service.db")
+		}
+
+		return newIlpRepos(conf.Ilp)
+	default:
+		logrus.Panicf("Unknown storage writer: %s", conf.Writer)
+		return nil, nil, nil
+	}
+}
+
+func newIlpRepos(conf config.IlpConfig) (repository.Trades, repository.Candles, func()) {
+	if conf.Db.Host == "" {
+		logrus.Panic("The ilp writer needs storage.ilp.db to read from QuestDB")
+	}
+
+	ilpDb, err := hAdaptor.ConnectDB(hAdaptor.PSQL, conf.Db)
+	if err != nil {
+		logrus.Panicf("Failed to connect to QuestDB: %v", err)
+	}
+
+	sender, err := ilp.NewSender(ilp.SenderOpt{
+		Protocol: conf.Protocol,
+		Address:  conf.Address,
+		Token:    conf.Token,
+		Timeout:  time.Duration(conf.Timeout),
+	})
+	if err != nil {
+		logrus.Panicf("Failed to create ILP sender: %v", err)
+	}
+
+	tradesRepo := ilp.NewTrades(sender, ilpDb, conf.RowsPerSend)
+
+	err = tradesRepo.EnsureTable(context.Background())
+	if err != nil {
+		logrus.Panicf("Failed to ensure trades table: %v", err)
+	}
+
+	candlesRepo := ilp.NewCandles(sender, ilpDb, conf.RowsPerSend)
+
+	// rollup tables are ensured with the others, 1m is not a rollup
+	err = candlesRepo.EnsureTable(context.Background(), time.Minute)
+	if err != nil {
+		logrus.Panicf("Failed to ensure candles table: %v", err)
+	}
+
+	logrus.
+		WithField("protocol", conf.Protocol).
+		WithField("address", conf.Address).
+		WithField("db_host", conf.Db.Host).
+		Info("Writing trades and candles over ILP")
+
+	closeStorage := func() {
+		err := sender.Close()
+		if err != nil {
+			logrus.
+				WithError(err).
+				Error("Failed to close ILP sender")
+		}
+
+		err = ilpDb.Close()
+		if err != nil {
+			logrus.
+				WithError(err).
+				Error("Failed to close QuestDB db")
+		}
+	}
+
+	return tradesRepo, candlesRepo, closeStorage
 }
 
-func createRouter(opts routerOpts, allowedOrigins []string) *gin.Engine {
+func newSpoolOpt(conf config.SpoolConfig) service.SpoolOpt {
+	opt := service.SpoolOpt{
+		RetryInterval:    time.Duration(conf.RetryInterval),
+		MaxRetryInterval: time.Duration(conf.MaxRetryInterval),
+		ChunkSize:        conf.ChunkSize,
+	}
+
+	if conf.Path == "" {
+		logrus.Warn("No spool path configured, trades failing to be stored are lost")
+		return opt
+	}
+
+	tradeSpool, err := spool.Open(conf.Path)
+	if err != nil {
+		logrus.Panicf("Failed to open spool: %v", err)
+	}
+
+	records, size := tradeSpool.Size()
+
+	logrus.
+		WithField("path", conf.Path).
+		WithField("records", records).
+		WithField("bytes", size).
+		Info("Spool opened")
+
+	opt.Spool = tradeSpool
+
+	return opt
+}
+
+func newRollupSizes(intervals []string) []time.Duration {
+	if intervals == nil {
+		intervals = []string{"5m", "15m", "1h", "4h", "1d"}
+	}
+
+	sizes := []time.Duration{}
+
+	for _, interval := range intervals {
+		size, err := common.ParseInterval(interval)
+		if err != nil {
+			logrus.Panicf("Invalid candle rollup: %v", err)
+		}
+
+		if size == time.Minute {
+			continue
+		}
+
+		sizes = append(sizes, size)
+	}
+
+	return sizes
+}
+
+func createRouter(opts routerOpts, allowedOrigins []string, adminToken string) *gin.Engine {
 	router := gin.New()
 
 	corsConfig := cors.DefaultConfig()
@@ -143,8 +536,16 @@ func createRouter(opts routerOpts, allowedOrigins []string) *gin.Engine {
 	)
 
 	corsRouting(router, corsConfig, allowedOrigins)
-	commonRouting(router, opts.handler.common)
+	commonRouting(router, opts.handler.common, opts.handler.health)
 	streamRouting(router, opts.handler.stream)
+	candleRouting(router, opts.handler.candle)
+	tradeRouting(router, opts.handler.trade)
+	pairRouting(router, opts.handler.pair)
+	orderBookRouting(router, opts.handler.orderBook)
+
+	admin := router.Group("/v1/admin", middleware.AdminAuth(adminToken))
+	gapRouting(admin, opts.handler.gap)
+	listenerRouting(admin, opts.handler.listener)
 
 	return router
 }
@@ -158,8 +559,10 @@ func corsRouting(router *gin.Engine, corsConfig cors.Config, allowedOrigins []st
 	router.Use(cors.New(corsConfig))
 }
 
-func commonRouting(router *gin.Engine, handler *hHandler.Common) {
-	router.GET("/health", handler.Health)
+func commonRouting(router *gin.Engine, handler *hHandler.Common, healthHandler *handler.Health) {
+	router.GET("/health", healthHandler.Health)
+	router.GET("/v1/status", healthHandler.Status)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	router.NoRoute(handler.NoRoute)
 }
 
@@ -172,3 +575,30 @@ func streamRouting(router *gin.Engine, handler *handler.Stream) {
 	router.GET("/v1/stream/start", handler.Start)
 	router.GET("/v1/stream/listened-symbol", handler.GetListenedSymbols)
 }
+
+func candleRouting(router *gin.Engine, handler *handler.Candle) {
+	router.GET("/v1/candles", handler.GetCandles)
+}
+
+func tradeRouting(router *gin.Engine, handler *handler.Trade) {
+	router.GET("/v1/trades", handler.GetTrades)
+}
+
+func pairRouting(router *gin.Engine, handler *handler.Pair) {
+	router.GET("/v1/pairs", handler.GetPairs)
+}
+
+func orderBookRouting(router *gin.Engine, handler *handler.OrderBook) {
+	router.GET("/v1/order-book", handler.GetOrderBook)
+}
+
+func gapRouting(router *gin.RouterGroup, handler *handler.Gap) {
+	router.GET("/gaps", handler.ScanGaps)
+	router.POST("/gaps/repair", handler.RepairGaps)
+	router.GET("/gaps/repairs", handler.GetRepairs)
+}
+
+func listenerRouting(router *gin.RouterGroup, handler *handler.Listener) {
+	router.POST("/pairs", handler.AddPairs)
+	router.DELETE("/pairs", handler.RemovePairs)
+}
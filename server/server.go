@@ -4,12 +4,14 @@ import (
 	"context"
 	"michaelyusak/go-market-ingestor.git/config"
 	"michaelyusak/go-market-ingestor.git/log"
+	"michaelyusak/go-market-ingestor.git/migration"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	hAdaptor "github.com/michaelyusak/go-helper/adaptor"
 	"github.com/sirupsen/logrus"
 )
 
@@ -28,10 +30,30 @@ func Init() {
 		logrus.Panic(err)
 	}
 
-	router := newRouter(&conf)
+	db, err := hAdaptor.ConnectDB(hAdaptor.PSQL, conf.Service.Db)
+	if err != nil {
+		logrus.Panicf("Failed to connect to db: %v", err)
+	}
+	logrus.Info("Connected to postgres")
+
+	if conf.Service.MigrateOnStart {
+		applied, err := migration.NewMigrator(db, migrationsFS()).Up(context.Background())
+		if err != nil {
+			logrus.Panicf("Failed to run migrations: %v", err)
+		}
+
+		logrus.
+			WithField("applied", applied).
+			Info("Migrations up to date")
+	}
+
+	listenCtx, stopListening := context.WithCancel(context.Background())
+	defer stopListening()
+
+	app := newApp(listenCtx, &conf, db)
 
 	srv := http.Server{
-		Handler: router,
+		Handler: app.router,
 		Addr:    conf.Service.Port,
 	}
 
@@ -54,14 +76,34 @@ func Init() {
 
 	APP_HEALTHY = false
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.Service.GracefulPeriod))
+	time.Sleep(time.Duration(conf.Service.GracefulPeriod))
+
+	shutdownTimeout := time.Duration(conf.Service.ShutdownTimeout)
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
-	<-ctx.Done()
+	stopListening()
+
+	report := shutdown(ctx, &srv, app, db)
+
+	entry := logrus.
+		WithField("trades_drained", report.TradesDrained).
+		WithField("trades_flushed", report.TradesFlushed).
+		WithField("trades_spooled", report.TradesSpooled).
+		WithField("trades_lost", report.TradesLost).
+		WithField("trades_unconfirmed", report.TradesUnconfirmed).
+		WithField("candles_lost", report.CandlesLost).
+		WithField("subscribers_closed", report.SubscribersClosed).
+		WithField("timed_out", report.TimedOut)
 
-	if err := srv.Shutdown(ctx); err != nil {
-		logrus.Fatalf("Server shut down with error: %s", err.Error())
+	if report.TradesLost > 0 || report.CandlesLost > 0 || report.TimedOut {
+		entry.Error("Server shut down with data lost")
+		return
 	}
 
-	logrus.Info("Server shut down")
+	entry.Info("Server shut down")
 }
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// shutdown stops the app in order, so every trade received is written before
+// the db goes away: the exchanges first, then the storage flushes what they
+// published, then the http server and stream websockets, and the db last.
+func shutdown(ctx context.Context, srv *http.Server, app app, db *sql.DB) entity.ShutdownReport {
+	closeExchanges(ctx, app.exchanges)
+
+	report := app.storageService.Shutdown(ctx)
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		logrus.
+			WithError(err).
+			Error("Failed to shut down http server")
+	}
+
+	// hijacked connections are left alone by srv.Shutdown
+	closed, err := app.streamHandler.Close(ctx)
+	if err != nil {
+		logrus.
+			WithError(err).
+			Error("Failed to close stream websockets")
+	}
+	report.SubscribersClosed = closed
+
+	app.closeStorage()
+
+	err = db.Close()
+	if err != nil {
+		logrus.
+			WithError(err).
+			Error("Failed to close db")
+	}
+
+	if ctx.Err() != nil {
+		report.TimedOut = true
+	}
+
+	return report
+}
+
+// closeExchanges stops every exchange adapter, waiting for their connections
+// to close until ctx is done.
+func closeExchanges(ctx context.Context, exchanges map[string]exchange.Exchage) {
+	var wg sync.WaitGroup
+
+	for name, ex := range exchanges {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err := ex.Close(ctx)
+			if err != nil {
+				logrus.
+					WithField("exchange", name).
+					WithError(err).
+					Error("Failed to close exchange adapter")
+				return
+			}
+
+			logrus.
+				WithField("exchange", name).
+				Info("Exchange adapter closed")
+		}()
+	}
+
+	wg.Wait()
+}
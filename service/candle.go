@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/common"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/repository"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+)
+
+type candle struct {
+	candlesRepo repository.Candles
+	storedSizes []time.Duration // ascending, starting at 1m
+
+	defaultLimit int
+	maxLimit     int
+}
+
+func NewCandle(
+	candlesRepo repository.Candles,
+	rollupSizes []time.Duration,
+) *candle {
+	storedSizes := append([]time.Duration{time.Minute}, rollupSizes...)
+	slices.Sort(storedSizes)
+
+	return &candle{
+		candlesRepo: candlesRepo,
+		storedSizes: storedSizes,
+
+		defaultLimit: 500,
+		maxLimit:     1000,
+	}
+}
+
+func (s *candle) GetCandles(ctx context.Context, req entity.GetCandlesReq) (entity.GetCandlesRes, error) {
+	if req.Interval == "" {
+		req.Interval = "1m"
+	}
+
+	size, err := common.ParseInterval(req.Interval)
+	if err != nil {
+		return entity.GetCandlesRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Message:         fmt.Sprintf("[service][candle][GetCandles][common.ParseInterval] %s", err.Error()),
+			ResponseMessage: err.Error(),
+		})
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = s.defaultLimit
+	}
+	limit = min(limit, s.maxLimit)
+
+	to := req.To
+	if to == 0 {
+		to = time.Now().Unix()
+	}
+
+	from := req.From
+	if from == 0 {
+		from = to - int64(limit)*int64(size.Seconds())
+	}
+
+	if req.Cursor != "" {
+		from, err = strconv.ParseInt(req.Cursor, 10, 64)
+		if err != nil {
+			return entity.GetCandlesRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+				Message:         fmt.Sprintf("[service][candle][GetCandles][strconv.ParseInt] invalid cursor: %s", req.Cursor),
+				ResponseMessage: "invalid cursor",
+			})
+		}
+	}
+
+	if from >= to {
+		return entity.GetCandlesRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Message:         fmt.Sprintf("[service][candle][GetCandles] invalid range: from %d to %d", from, to),
+			ResponseMessage: "from must be before to",
+		})
+	}
+
+	baseSize := s.baseSize(size)
+
+	// Every bucket holds at most rowsPerCandle rows, so fetching one bucket
+	// more than needed guarantees the returned buckets are complete.
+	rowsPerCandle := int(size / baseSize)
+	rowsLimit := (limit + 1) * rowsPerCandle
+
+	rows, err := s.candlesRepo.GetRange(ctx, baseSize, req.Exchange, req.Symbol, time.Unix(from, 0), time.Unix(to, 0), rowsLimit)
+	if err != nil {
+		return entity.GetCandlesRes{}, fmt.Errorf("[service][candle][GetCandles][candlesRepo.GetRange] %w", err)
+	}
+
+	candles := common.AggregateCandles(rows, size)
+
+	res := entity.GetCandlesRes{
+		Candles: candles,
+	}
+
+	if len(candles) > limit {
+		res.Candles = candles[:limit]
+		res.NextCursor = strconv.FormatInt(candles[limit].Epoch, 10)
+	}
+
+	return res, nil
+}
+
+// baseSize picks the largest stored resolution that evenly divides size.
+func (s *candle) baseSize(size time.Duration) time.Duration {
+	base := time.Minute
+
+	for _, stored := range s.storedSizes {
+		if stored <= size && size%stored == 0 {
+			base = stored
+		}
+	}
+
+	return base
+}
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/repository"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+type GapOpt struct {
+	Interval time.Duration // how often the background job runs, 0 disables it
+	Lookback time.Duration // range scanned by the background job
+	MinGap   time.Duration // shorter gaps are ignored
+}
+
+type gap struct {
+	candlesRepo     repository.Candles
+	backfillers     map[string]exchange.Backfiller
+	listenedSymbols func() []string
+
+	interval time.Duration
+	lookback time.Duration
+	minGap   time.Duration
+	maxRange time.Duration
+	// storage flushes once a minute, so the latest minutes are not written yet
+	settleDelay time.Duration
+
+	repairs    []entity.GapRepair // newest last
+	maxRepairs int
+	// exchange:symbol -> ranges already repaired, skipped by the background job
+	attempted map[string][]entity.CandleGap
+
+	mu sync.Mutex
+}
+
+func NewGap(
+	candlesRepo repository.Candles,
+	backfillers map[string]exchange.Backfiller,
+	listenedSymbols func() []string,
+	opt GapOpt,
+) *gap {
+	if opt.Lookback <= 0 {
+		opt.Lookback = 6 * time.Hour
+	}
+
+	if opt.MinGap < time.Minute {
+		opt.MinGap = time.Minute
+	}
+
+	return &gap{
+		candlesRepo:     candlesRepo,
+		backfillers:     backfillers,
+		listenedSymbols: listenedSymbols,
+
+		interval:    opt.Interval,
+		lookback:    opt.Lookback,
+		minGap:      opt.MinGap,
+		maxRange:    7 * 24 * time.Hour,
+		settleDelay: 2 * time.Minute,
+
+		repairs:    []entity.GapRepair{},
+		maxRepairs: 1000,
+		attempted:  map[string][]entity.CandleGap{},
+	}
+}
+
+func (s *gap) Start() {
+	if s.interval <= 0 {
+		logrus.Info("[service][gap][Start] gap repair job disabled")
+		return
+	}
+
+	go s.runRepairJob(context.Background())
+}
+
+func (s *gap) runRepairJob(ctx context.Context) {
+	logrus.
+		WithField("interval", s.interval.String()).
+		WithField("lookback", s.lookback.String()).
+		Info("[service][gap][runRepairJob] running gap repair job")
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c, cancel := context.WithTimeout(ctx, s.interval)
+
+		res, err := s.repairGaps(c, entity.ScanGapsReq{}, true)
+		cancel()
+		if err != nil {
+			logrus.
+				WithError(err).
+				Error("[service][gap][runRepairJob][repairGaps]")
+			continue
+		}
+
+		if len(res.Repairs) > 0 {
+			logrus.
+				WithField("repairs", len(res.Repairs)).
+				Info("[service][gap][runRepairJob] gaps repaired")
+		}
+	}
+}
+
+func (s *gap) ScanGaps(ctx context.Context, req entity.ScanGapsReq) (entity.ScanGapsRes, error) {
+	symbols, from, to, err := s.scanRange(req)
+	if err != nil {
+		return entity.ScanGapsRes{}, err
+	}
+
+	gaps := []entity.CandleGap{}
+
+	for _, symbol := range symbols {
+		exchangeName, pair, _ := strings.Cut(symbol, ":")
+
+		symbolGaps, err := s.findGaps(ctx, exchangeName, pair, from, to)
+		if err != nil {
+			return entity.ScanGapsRes{}, fmt.Errorf("[service][gap][ScanGaps][findGaps] %w", err)
+		}
+
+		gaps = append(gaps, symbolGaps...)
+	}
+
+	return entity.ScanGapsRes{
+		Gaps: gaps,
+	}, nil
+}
+
+func (s *gap) RepairGaps(ctx context.Context, req entity.ScanGapsReq) (entity.RepairGapsRes, error) {
+	return s.repairGaps(ctx, req, false)
+}
+
+// repairGaps backfills every gap found in the range. With skipAttempted, the
+// parts of gaps already repaired before are left alone so quiet pairs are not
+// refetched on every run, even as the scan window moves their gaps' bounds.
+func (s *gap) repairGaps(ctx context.Context, req entity.ScanGapsReq, skipAttempted bool) (entity.RepairGapsRes, error) {
+	scan, err := s.ScanGaps(ctx, req)
+	if err != nil {
+		return entity.RepairGapsRes{}, fmt.Errorf("[service][gap][repairGaps][ScanGaps] %w", err)
+	}
+
+	repairs := []entity.GapRepair{}
+
+	for _, candleGap := range scan.Gaps {
+		if skipAttempted {
+			var ok bool
+
+			candleGap, ok = s.unattempted(candleGap)
+			if !ok {
+				continue
+			}
+		}
+
+		repair := s.repairGap(ctx, candleGap)
+		s.recordRepair(repair)
+
+		repairs = append(repairs, repair)
+	}
+
+	return entity.RepairGapsRes{
+		Repairs: repairs,
+	}, nil
+}
+
+func (s *gap) repairGap(ctx context.Context, candleGap entity.CandleGap) entity.GapRepair {
+	repair := entity.GapRepair{
+		Gap:        candleGap,
+		RepairedAt: time.Now().Unix(),
+	}
+
+	backfiller, ok := s.backfillers[candleGap.Exchange]
+	if !ok {
+		repair.Status = entity.GapRepairStatusUnsupported
+		return repair
+	}
+
+	n, err := backfiller.Backfill(ctx, []string{candleGap.Symbol}, time.Unix(candleGap.From, 0), time.Unix(candleGap.To, 0))
+	if errors.Is(err, exchange.ErrBackfillOutOfRange) {
+		logrus.
+			WithError(err).
+			WithField("exchange", candleGap.Exchange).
+			WithField("symbol", candleGap.Symbol).
+			WithField("from", candleGap.From).
+			WithField("to", candleGap.To).
+			Info("[service][gap][repairGap][backfiller.Backfill] gap out of backfill range")
+
+		repair.Status = entity.GapRepairStatusOutOfRange
+		repair.Trades = n
+		repair.Error = err.Error()
+		return repair
+	}
+
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("exchange", candleGap.Exchange).
+			WithField("symbol", candleGap.Symbol).
+			WithField("from", candleGap.From).
+			WithField("to", candleGap.To).
+			Warn("[service][gap][repairGap][backfiller.Backfill]")
+
+		repair.Status = entity.GapRepairStatusFailed
+		repair.Trades = n
+		repair.Error = err.Error()
+		return repair
+	}
+
+	repair.Status = entity.GapRepairStatusBackfilled
+	if n == 0 {
+		repair.Status = entity.GapRepairStatusNoTrades
+	}
+	repair.Trades = n
+
+	return repair
+}
+
+func (s *gap) GetRepairs() []entity.GapRepair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.repairs)
+}
+
+func (s *gap) scanRange(req entity.ScanGapsReq) ([]string, time.Time, time.Time, error) {
+	listened := s.listenedSymbols()
+
+	symbols := req.Symbols
+	if len(symbols) == 0 {
+		symbols = listened
+	}
+
+	for _, symbol := range symbols {
+		if !slices.Contains(listened, symbol) {
+			return nil, time.Time{}, time.Time{}, apperror.BadRequestError(apperror.AppErrorOpt{
+				Message:         fmt.Sprintf("[service][gap][scanRange] symbol is not listened: %s", symbol),
+				ResponseMessage: fmt.Sprintf("symbol is not listened: %s", symbol),
+			})
+		}
+	}
+
+	to := time.Now().Add(-s.settleDelay).Truncate(time.Minute)
+	if req.To != 0 {
+		to = time.Unix(req.To, 0).Truncate(time.Minute)
+	}
+
+	from := to.Add(-s.lookback)
+	if req.From != 0 {
+		from = time.Unix(req.From, 0).Truncate(time.Minute)
+	}
+
+	if !from.Before(to) {
+		return nil, time.Time{}, time.Time{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Message:         fmt.Sprintf("[service][gap][scanRange] invalid range: from %d to %d", from.Unix(), to.Unix()),
+			ResponseMessage: "from must be before to",
+		})
+	}
+
+	if to.Sub(from) > s.maxRange {
+		return nil, time.Time{}, time.Time{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Message:         fmt.Sprintf("[service][gap][scanRange] range too large: from %d to %d", from.Unix(), to.Unix()),
+			ResponseMessage: fmt.Sprintf("range must not exceed %s", s.maxRange.String()),
+		})
+	}
+
+	return symbols, from, to, nil
+}
+
+// findGaps walks the stored 1m candles in [from, to) and reports every run of
+// missing minutes at least minGap long.
+func (s *gap) findGaps(ctx context.Context, exchangeName, symbol string, from, to time.Time) ([]entity.CandleGap, error) {
+	limit := int(to.Sub(from) / time.Minute)
+
+	candles, err := s.candlesRepo.GetRange(ctx, time.Minute, exchangeName, symbol, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("[service][gap][findGaps][candlesRepo.GetRange] %w", err)
+	}
+
+	gaps := []entity.CandleGap{}
+
+	expected := from.Unix()
+
+	addGap := func(end int64) {
+		if time.Duration(end-expected)*time.Second < s.minGap {
+			return
+		}
+
+		gaps = append(gaps, entity.CandleGap{
+			Exchange: exchangeName,
+			Symbol:   symbol,
+			From:     expected,
+			To:       end,
+			Minutes:  (end - expected) / 60,
+		})
+	}
+
+	for _, candle := range candles {
+		if candle.Epoch > expected {
+			addGap(candle.Epoch)
+		}
+
+		expected = candle.Epoch + 60
+	}
+
+	if expected < to.Unix() {
+		addGap(to.Unix())
+	}
+
+	return gaps, nil
+}
+
+// unattempted trims off the ends of candleGap already repaired and reports
+// whether what is left is still worth repairing.
+func (s *gap) unattempted(candleGap entity.CandleGap) (entity.CandleGap, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ranges := s.attempted[candleGap.Exchange+":"+candleGap.Symbol]
+
+	for trimmed := true; trimmed && candleGap.From < candleGap.To; {
+		trimmed = false
+
+		for _, r := range ranges {
+			if r.From <= candleGap.From && candleGap.From < r.To {
+				candleGap.From = r.To
+				trimmed = true
+			}
+
+			if r.From < candleGap.To && candleGap.To <= r.To {
+				candleGap.To = r.From
+				trimmed = true
+			}
+		}
+	}
+
+	if candleGap.From >= candleGap.To || time.Duration(candleGap.To-candleGap.From)*time.Second < s.minGap {
+		return entity.CandleGap{}, false
+	}
+
+	candleGap.Minutes = (candleGap.To - candleGap.From) / 60
+
+	return candleGap, true
+}
+
+func (s *gap) recordRepair(repair entity.GapRepair) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.repairs = append(s.repairs, repair)
+	if len(s.repairs) > s.maxRepairs {
+		s.repairs = s.repairs[len(s.repairs)-s.maxRepairs:]
+	}
+
+	key := repair.Gap.Exchange + ":" + repair.Gap.Symbol
+
+	if repair.Status != entity.GapRepairStatusFailed {
+		// merge the ranges the repair overlaps or touches
+		merged := repair.Gap
+		ranges := []entity.CandleGap{}
+
+		for _, r := range s.attempted[key] {
+			if r.From <= merged.To && merged.From <= r.To {
+				merged.From = min(merged.From, r.From)
+				merged.To = max(merged.To, r.To)
+				continue
+			}
+
+			ranges = append(ranges, r)
+		}
+
+		s.attempted[key] = append(ranges, merged)
+	}
+
+	// gaps older than the lookback window are never scanned by the job again
+	cutoff := time.Now().Add(-s.lookback - s.settleDelay).Unix()
+	for k, ranges := range s.attempted {
+		ranges = slices.DeleteFunc(ranges, func(r entity.CandleGap) bool {
+			return r.To < cutoff
+		})
+
+		if len(ranges) == 0 {
+			delete(s.attempted, k)
+			continue
+		}
+
+		s.attempted[k] = ranges
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"testing"
+	"time"
+)
+
+type stubCandles struct {
+	epochs []int64 // stored 1m candles, ascending
+}
+
+func (r *stubCandles) EnsureTable(ctx context.Context, size time.Duration) error {
+	return nil
+}
+
+func (r *stubCandles) UpsertMany(ctx context.Context, size time.Duration, candles []entity.Candle) error {
+	return nil
+}
+
+func (r *stubCandles) GetRange(ctx context.Context, size time.Duration, exchangeName, symbol string, from, to time.Time, limit int) ([]entity.Candle, error) {
+	candles := []entity.Candle{}
+
+	for _, epoch := range r.epochs {
+		if epoch >= from.Unix() && epoch < to.Unix() && len(candles) < limit {
+			candles = append(candles, entity.Candle{Epoch: epoch, Exchange: exchangeName, Symbol: symbol})
+		}
+	}
+
+	return candles, nil
+}
+
+type stubBackfiller struct {
+	calls [][2]int64
+	err   error
+}
+
+func (b *stubBackfiller) Backfill(ctx context.Context, pairs []string, from, to time.Time) (int, error) {
+	b.calls = append(b.calls, [2]int64{from.Unix(), to.Unix()})
+
+	return 0, b.err
+}
+
+func newTestGap(candles *stubCandles, backfiller *stubBackfiller) *gap {
+	return NewGap(
+		candles,
+		map[string]exchange.Backfiller{"indodax": backfiller},
+		func() []string { return []string{"indodax:btcidr"} },
+		GapOpt{MinGap: 5 * time.Minute},
+	)
+}
+
+func TestFindGaps(t *testing.T) {
+	base := time.Now().Truncate(time.Minute).Add(-time.Hour).Unix()
+	minute := int64(60)
+
+	candles := &stubCandles{epochs: []int64{
+		base + 2*minute,
+		base + 3*minute,
+		// 4 to 9 missing, 6 minutes
+		base + 10*minute,
+		// 11 to 12 missing, shorter than minGap
+		base + 13*minute,
+	}}
+
+	s := newTestGap(candles, &stubBackfiller{})
+
+	gaps, err := s.findGaps(context.Background(), "indodax", "btcidr", time.Unix(base, 0), time.Unix(base+20*minute, 0))
+	if err != nil {
+		t.Fatalf("findGaps: %v", err)
+	}
+
+	want := []entity.CandleGap{
+		{From: base + 4*minute, To: base + 10*minute, Minutes: 6},
+		{From: base + 14*minute, To: base + 20*minute, Minutes: 6},
+	}
+
+	if len(gaps) != len(want) {
+		t.Fatalf("gaps = %+v, want %+v", gaps, want)
+	}
+
+	for i, g := range gaps {
+		if g.From != want[i].From || g.To != want[i].To || g.Minutes != want[i].Minutes {
+			t.Errorf("gap %d = %+v, want %+v", i, g, want[i])
+		}
+	}
+}
+
+func TestRepairGapsSkipsAttempted(t *testing.T) {
+	base := time.Now().Truncate(time.Minute).Add(-time.Hour).Unix()
+	minute := int64(60)
+
+	// a quiet pair, nothing stored after its last candle
+	candles := &stubCandles{epochs: []int64{base}}
+	backfiller := &stubBackfiller{}
+
+	s := newTestGap(candles, backfiller)
+
+	runs := []struct {
+		name     string
+		from, to int64
+		want     [][2]int64
+	}{
+		{
+			name: "first run repairs the gap",
+			from: base, to: base + 30*minute,
+			want: [][2]int64{{base + minute, base + 30*minute}},
+		},
+		{
+			name: "same gap again",
+			from: base, to: base + 30*minute,
+		},
+		{
+			name: "window end moved less than minGap",
+			from: base, to: base + 33*minute,
+		},
+		{
+			name: "window end moved past minGap, only the new part is repaired",
+			from: base, to: base + 40*minute,
+			want: [][2]int64{{base + 30*minute, base + 40*minute}},
+		},
+		{
+			name: "window start moved into the repaired part",
+			from: base + 10*minute, to: base + 40*minute,
+		},
+	}
+
+	for _, run := range runs {
+		backfiller.calls = nil
+
+		_, err := s.repairGaps(context.Background(), entity.ScanGapsReq{From: run.from, To: run.to}, true)
+		if err != nil {
+			t.Fatalf("%s: repairGaps: %v", run.name, err)
+		}
+
+		if len(backfiller.calls) != len(run.want) {
+			t.Fatalf("%s: backfilled %v, want %v", run.name, backfiller.calls, run.want)
+		}
+
+		for i, call := range backfiller.calls {
+			if call != run.want[i] {
+				t.Errorf("%s: backfilled %v, want %v", run.name, call, run.want[i])
+			}
+		}
+	}
+}
+
+func TestRepairGapsRetriesFailed(t *testing.T) {
+	base := time.Now().Truncate(time.Minute).Add(-time.Hour).Unix()
+	minute := int64(60)
+
+	backfiller := &stubBackfiller{err: errors.New("unavailable")}
+
+	s := newTestGap(&stubCandles{}, backfiller)
+
+	req := entity.ScanGapsReq{From: base, To: base + 30*minute}
+
+	for range 2 {
+		_, err := s.repairGaps(context.Background(), req, true)
+		if err != nil {
+			t.Fatalf("repairGaps: %v", err)
+		}
+	}
+
+	if len(backfiller.calls) != 2 {
+		t.Errorf("backfilled %d times, want a failed repair retried", len(backfiller.calls))
+	}
+}
@@ -8,11 +8,51 @@ import (
 type Storage interface {
 	IngestTradeActivity(ctx context.Context, fullSignalCh chan bool)
 	ProcessTradesInBatch(ctx context.Context, fullSignalCh chan bool)
+	Shutdown(ctx context.Context) entity.ShutdownReport
 }
 
 type Stream interface {
 	CreateCandleStream(ctx context.Context, req entity.CreateStreamReq) (entity.CreateStreamRes, error)
 	StreamCandles(ctx context.Context, ch chan []byte, channel, token string) error
 	Stop(channel, token string) error
+	Subscribe(channel, token string, symbols []string) error
+	Unsubscribe(channel, token string, symbols []string) error
 	GetListenedSymbols() []string
+	AddListenedSymbols(symbols []string)
+	RemoveListenedSymbols(symbols []string)
+	SendAlert(alert entity.StaleAlert) error
+}
+
+type Candle interface {
+	GetCandles(ctx context.Context, req entity.GetCandlesReq) (entity.GetCandlesRes, error)
+}
+
+type Trade interface {
+	GetTrades(ctx context.Context, req entity.GetTradesReq) (entity.GetTradesRes, error)
+}
+
+type OrderBook interface {
+	GetOrderBook(ctx context.Context, req entity.GetOrderBookReq) (entity.OrderBook, error)
+}
+
+type Gap interface {
+	ScanGaps(ctx context.Context, req entity.ScanGapsReq) (entity.ScanGapsRes, error)
+	RepairGaps(ctx context.Context, req entity.ScanGapsReq) (entity.RepairGapsRes, error)
+	GetRepairs() []entity.GapRepair
+}
+
+type Pair interface {
+	GetPairs(ctx context.Context, req entity.GetPairsReq) ([]entity.PairMeta, error)
+	SelectTradable(exchangeName string, pairs []string) []string
+	Unwatch(exchangeName string, pairs []string)
+}
+
+type Listener interface {
+	AddPairs(ctx context.Context, req entity.UpdatePairsReq) (entity.UpdatePairsRes, error)
+	RemovePairs(ctx context.Context, req entity.UpdatePairsReq) (entity.UpdatePairsRes, error)
+}
+
+type Status interface {
+	GetStatus() entity.StatusRes
+	Ready() bool
 }
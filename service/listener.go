@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"michaelyusak/go-market-ingestor.git/common"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+type listener struct {
+	pairService   Pair
+	streamService Stream
+	managers      map[string]exchange.PairManager
+
+	mu sync.Mutex
+}
+
+func NewListener(
+	pairService Pair,
+	streamService Stream,
+	managers map[string]exchange.PairManager,
+) *listener {
+	return &listener{
+		pairService:   pairService,
+		streamService: streamService,
+		managers:      managers,
+	}
+}
+
+func (s *listener) manager(exchangeName string) (exchange.PairManager, error) {
+	manager, ok := s.managers[exchangeName]
+	if !ok {
+		return nil, apperror.BadRequestError(apperror.AppErrorOpt{
+			Message:         fmt.Sprintf("[service][listener][manager] unknown exchange: %s", exchangeName),
+			ResponseMessage: fmt.Sprintf("unknown exchange: %s", exchangeName),
+		})
+	}
+
+	return manager, nil
+}
+
+// AddPairs starts listening to the tradable pairs of the request that are not
+// listened yet, or whose shard was given up on.
+func (s *listener) AddPairs(ctx context.Context, req entity.UpdatePairsReq) (entity.UpdatePairsRes, error) {
+	manager, err := s.manager(req.Exchange)
+	if err != nil {
+		return entity.UpdatePairsRes{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := entity.UpdatePairsRes{
+		Exchange: req.Exchange,
+		Updated:  []string{},
+		Skipped:  []string{},
+	}
+
+	listened := s.streamService.GetListenedSymbols()
+
+	candidates := []string{}
+	for _, pair := range normalizePairs(req.Pairs) {
+		if slices.Contains(listened, common.ListenedSymbol(req.Exchange, pair)) && manager.Listens(pair) {
+			res.Skipped = append(res.Skipped, pair)
+			continue
+		}
+
+		candidates = append(candidates, pair)
+	}
+
+	tradable := s.pairService.SelectTradable(req.Exchange, candidates)
+
+	symbols := []string{}
+	for _, pair := range candidates {
+		if !slices.Contains(tradable, pair) {
+			res.Skipped = append(res.Skipped, pair)
+			continue
+		}
+
+		res.Updated = append(res.Updated, pair)
+		symbols = append(symbols, common.ListenedSymbol(req.Exchange, pair))
+	}
+
+	if len(res.Updated) == 0 {
+		return res, nil
+	}
+
+	manager.AddPairs(res.Updated)
+	s.streamService.AddListenedSymbols(symbols)
+
+	logrus.
+		WithField("exchange", req.Exchange).
+		WithField("pairs", res.Updated).
+		Info("[service][listener][AddPairs] pairs added")
+
+	return res, nil
+}
+
+// RemovePairs stops listening to the listened pairs of the request.
+func (s *listener) RemovePairs(ctx context.Context, req entity.UpdatePairsReq) (entity.UpdatePairsRes, error) {
+	manager, err := s.manager(req.Exchange)
+	if err != nil {
+		return entity.UpdatePairsRes{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := entity.UpdatePairsRes{
+		Exchange: req.Exchange,
+		Updated:  []string{},
+		Skipped:  []string{},
+	}
+
+	listened := s.streamService.GetListenedSymbols()
+
+	symbols := []string{}
+	for _, pair := range normalizePairs(req.Pairs) {
+		symbol := common.ListenedSymbol(req.Exchange, pair)
+		if !slices.Contains(listened, symbol) {
+			res.Skipped = append(res.Skipped, pair)
+			continue
+		}
+
+		res.Updated = append(res.Updated, pair)
+		symbols = append(symbols, symbol)
+	}
+
+	if len(res.Updated) == 0 {
+		return res, nil
+	}
+
+	manager.RemovePairs(res.Updated)
+	s.streamService.RemoveListenedSymbols(symbols)
+	s.pairService.Unwatch(req.Exchange, res.Updated)
+
+	logrus.
+		WithField("exchange", req.Exchange).
+		WithField("pairs", res.Updated).
+		Info("[service][listener][RemovePairs] pairs removed")
+
+	return res, nil
+}
+
+// normalizePairs lower cases and dedupes pairs, as both adapters subscribe
+// with lower case pairs.
+func normalizePairs(pairs []string) []string {
+	normalized := []string{}
+
+	for _, pair := range pairs {
+		pair = strings.ToLower(strings.TrimSpace(pair))
+		if pair == "" || slices.Contains(normalized, pair) {
+			continue
+		}
+
+		normalized = append(normalized, pair)
+	}
+
+	return normalized
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/common"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"net/http"
+	"sync"
+
+	"github.com/michaelyusak/go-helper/apperror"
+)
+
+// orderBook keeps the latest order book published per listened symbol, so
+// clients can read a snapshot without holding a websocket.
+type orderBook struct {
+	orderBookCh <-chan entity.OrderBook
+
+	books map[string]entity.OrderBook // exchange:symbol -> latest book
+
+	mu sync.RWMutex
+}
+
+func NewOrderBook(
+	orderBookCh <-chan entity.OrderBook,
+) *orderBook {
+	return &orderBook{
+		orderBookCh: orderBookCh,
+
+		books: map[string]entity.OrderBook{},
+	}
+}
+
+func (s *orderBook) Start() {
+	go func() {
+		for ob := range s.orderBookCh {
+			s.mu.Lock()
+			s.books[common.ListenedSymbol(ob.Exchange, ob.Symbol)] = ob
+			s.mu.Unlock()
+		}
+	}()
+}
+
+func (s *orderBook) GetOrderBook(ctx context.Context, req entity.GetOrderBookReq) (entity.OrderBook, error) {
+	if req.Depth < 0 {
+		return entity.OrderBook{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Message:         fmt.Sprintf("[service][orderBook][GetOrderBook] invalid depth: %d", req.Depth),
+			ResponseMessage: "depth must not be negative",
+		})
+	}
+
+	symbol := common.ListenedSymbol(req.Exchange, req.Symbol)
+
+	s.mu.RLock()
+	ob, ok := s.books[symbol]
+	s.mu.RUnlock()
+
+	if !ok {
+		return entity.OrderBook{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			Message:         fmt.Sprintf("[service][orderBook][GetOrderBook] no order book for %s", symbol),
+			ResponseMessage: fmt.Sprintf("no order book for %s", symbol),
+		})
+	}
+
+	// the stored levels are shared with other readers, so only reslice
+	if req.Depth > 0 {
+		ob.Bids = ob.Bids[:min(req.Depth, len(ob.Bids))]
+		ob.Asks = ob.Asks[:min(req.Depth, len(ob.Asks))]
+	}
+
+	return ob, nil
+}
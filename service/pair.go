@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/repository"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type pair struct {
+	pairMetaRepo repository.PairMeta
+	fetchers     map[string]exchange.PairMetaFetcher
+
+	refreshInterval time.Duration
+	fetchTimeout    time.Duration
+
+	metas   map[string]map[string]entity.PairMeta // exchange -> lower case pair id -> meta
+	watched map[string][]string                   // exchange -> pairs asked to be listened
+
+	mu sync.RWMutex
+}
+
+func NewPair(
+	pairMetaRepo repository.PairMeta,
+	fetchers map[string]exchange.PairMetaFetcher,
+	refreshInterval time.Duration,
+) *pair {
+	if refreshInterval <= 0 {
+		refreshInterval = time.Hour
+	}
+
+	return &pair{
+		pairMetaRepo: pairMetaRepo,
+		fetchers:     fetchers,
+
+		refreshInterval: refreshInterval,
+		fetchTimeout:    30 * time.Second,
+
+		metas:   map[string]map[string]entity.PairMeta{},
+		watched: map[string][]string{},
+	}
+}
+
+// Load fills the cache from the database, then from the exchanges, so pairs
+// can still be checked at startup when an exchange API is down.
+func (s *pair) Load(ctx context.Context) {
+	metas, err := s.pairMetaRepo.GetAll(ctx)
+	if err != nil {
+		logrus.
+			WithError(err).
+			Warn("[service][pair][Load][pairMetaRepo.GetAll]")
+	} else {
+		s.store(metas)
+	}
+
+	s.refresh(ctx)
+}
+
+func (s *pair) Start() {
+	go func() {
+		ticker := time.NewTicker(s.refreshInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.refresh(context.Background())
+		}
+	}()
+}
+
+func (s *pair) refresh(ctx context.Context) {
+	for exchangeName, fetcher := range s.fetchers {
+		c, cancel := context.WithTimeout(ctx, s.fetchTimeout)
+		err := s.refreshExchange(c, exchangeName, fetcher)
+		cancel()
+		if err != nil {
+			logrus.
+				WithError(err).
+				WithField("exchange", exchangeName).
+				Warn("[service][pair][refresh][refreshExchange]")
+		}
+	}
+}
+
+func (s *pair) refreshExchange(ctx context.Context, exchangeName string, fetcher exchange.PairMetaFetcher) error {
+	metas, err := fetcher.FetchPairMeta(ctx)
+	if err != nil {
+		return fmt.Errorf("[service][pair][refreshExchange][fetcher.FetchPairMeta] %w", err)
+	}
+
+	s.store(metas)
+	s.flagWatched(exchangeName)
+
+	err = s.pairMetaRepo.UpsertMany(ctx, metas)
+	if err != nil {
+		return fmt.Errorf("[service][pair][refreshExchange][pairMetaRepo.UpsertMany] %w", err)
+	}
+
+	logrus.
+		WithField("exchange", exchangeName).
+		WithField("pairs", len(metas)).
+		Info("[service][pair][refreshExchange] pair metadata refreshed")
+
+	return nil
+}
+
+func (s *pair) store(metas []entity.PairMeta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, meta := range metas {
+		if _, ok := s.metas[meta.Exchange]; !ok {
+			s.metas[meta.Exchange] = map[string]entity.PairMeta{}
+		}
+
+		s.metas[meta.Exchange][strings.ToLower(meta.ID)] = meta
+	}
+}
+
+// flagWatched warns about listened pairs that stopped trading since they were
+// subscribed. It does not unsubscribe them: a suspended pair simply goes quiet,
+// and is dropped with the admin pairs endpoint if it is not coming back.
+func (s *pair) flagWatched(exchangeName string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.watched[exchangeName] {
+		meta, ok := s.metas[exchangeName][strings.ToLower(p)]
+		if !ok || meta.IsTradable() {
+			continue
+		}
+
+		logrus.
+			WithField("exchange", exchangeName).
+			WithField("pair", p).
+			WithField("suspended", meta.IsSuspended).
+			WithField("maintenance", meta.IsMaintenance).
+			Warn("[service][pair][flagWatched] listened pair is not tradable")
+	}
+}
+
+// SelectTradable returns the pairs that are known to the exchange and neither
+// suspended nor in maintenance, and watches them. Without metadata for the
+// exchange every pair is returned as is. Pairs are only selected when they
+// start being listened; refreshes flag watched pairs but never drop them.
+func (s *pair) SelectTradable(exchangeName string, pairs []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range pairs {
+		if !slices.Contains(s.watched[exchangeName], p) {
+			s.watched[exchangeName] = append(s.watched[exchangeName], p)
+		}
+	}
+
+	metas, ok := s.metas[exchangeName]
+	if !ok || len(metas) == 0 {
+		logrus.
+			WithField("exchange", exchangeName).
+			Warn("[service][pair][SelectTradable] no pair metadata, listening to every pair")
+		return pairs
+	}
+
+	tradable := []string{}
+
+	for _, p := range pairs {
+		meta, ok := metas[strings.ToLower(p)]
+		if !ok {
+			logrus.
+				WithField("exchange", exchangeName).
+				WithField("pair", p).
+				Warn("[service][pair][SelectTradable] unknown pair, skipping")
+			continue
+		}
+
+		if !meta.IsTradable() {
+			logrus.
+				WithField("exchange", exchangeName).
+				WithField("pair", p).
+				WithField("suspended", meta.IsSuspended).
+				WithField("maintenance", meta.IsMaintenance).
+				Warn("[service][pair][SelectTradable] pair is not tradable, skipping")
+			continue
+		}
+
+		tradable = append(tradable, p)
+	}
+
+	return tradable
+}
+
+// Unwatch stops flagging pairs that are no longer listened.
+func (s *pair) Unwatch(exchangeName string, pairs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.watched[exchangeName] = slices.DeleteFunc(s.watched[exchangeName], func(p string) bool {
+		return slices.Contains(pairs, p)
+	})
+}
+
+func (s *pair) GetPairs(ctx context.Context, req entity.GetPairsReq) ([]entity.PairMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pairs := []entity.PairMeta{}
+
+	for exchangeName, metas := range s.metas {
+		if req.Exchange != "" && req.Exchange != exchangeName {
+			continue
+		}
+
+		for _, meta := range metas {
+			pairs = append(pairs, meta)
+		}
+	}
+
+	slices.SortFunc(pairs, func(a, b entity.PairMeta) int {
+		if c := strings.Compare(a.Exchange, b.Exchange); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return pairs, nil
+}
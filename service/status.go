@@ -0,0 +1,69 @@
+package service
+
+import (
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"time"
+)
+
+type status struct {
+	appHealthy      *bool
+	supervisors     []*exchange.Supervisor
+	silentThreshold time.Duration
+	// a silent shard keeps the service ready, only marking it degraded
+	silentDegradesOnly bool
+}
+
+func NewStatus(
+	appHealthy *bool,
+	supervisors []*exchange.Supervisor,
+	silentThreshold time.Duration,
+	silentDegradesOnly bool,
+) *status {
+	if silentThreshold <= 0 {
+		silentThreshold = 2 * time.Minute
+	}
+
+	return &status{
+		appHealthy:      appHealthy,
+		supervisors:     supervisors,
+		silentThreshold: silentThreshold,
+
+		silentDegradesOnly: silentDegradesOnly,
+	}
+}
+
+// GetStatus reports every adapter shard. The service is ready once the
+// server is up and no shard has given up or gone silent. A silent shard also
+// marks the service degraded, and only that with silentDegradesOnly.
+func (s *status) GetStatus() entity.StatusRes {
+	res := entity.StatusRes{
+		Ready:           *s.appHealthy,
+		SilentThreshold: s.silentThreshold.String(),
+		Shards:          []entity.ShardStatus{},
+	}
+
+	for _, supervisor := range s.supervisors {
+		for _, shard := range supervisor.Status(s.silentThreshold) {
+			if shard.State == entity.ShardStateFailed {
+				res.Ready = false
+			}
+
+			if shard.Silent {
+				res.Degraded = true
+
+				if !s.silentDegradesOnly {
+					res.Ready = false
+				}
+			}
+
+			res.Shards = append(res.Shards, shard)
+		}
+	}
+
+	return res
+}
+
+func (s *status) Ready() bool {
+	return s.GetStatus().Ready
+}
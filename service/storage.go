@@ -3,35 +3,78 @@ package service
 import (
 	"context"
 	"fmt"
+	"michaelyusak/go-market-ingestor.git/common"
 	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/metrics"
 	"michaelyusak/go-market-ingestor.git/repository"
+	"michaelyusak/go-market-ingestor.git/spool"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// SpoolOpt keeps the trades that failed to be written in Spool and replays
+// them in the background, retrying with a backoff doubling from RetryInterval
+// up to MaxRetryInterval.
+type SpoolOpt struct {
+	Spool            *spool.Spool // nil disables spooling
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	ChunkSize        int
+}
+
 type storage struct {
 	tradesRepo      repository.Trades
-	candles1mRepo   repository.Candles1m
-	tradeActivityCh chan entity.TradeActivityV2
+	candlesRepo     repository.Candles
+	rollupSizes     []time.Duration
+	tradeActivityCh <-chan entity.TradeActivityV2
+	tradeBackfillCh <-chan entity.TradeActivityV2
 	candle1mBuffer  entity.Candle
 	tradesBuffer    []entity.TradeActivityV2
+	inFlight        int // trades of the running batch not stored or spooled yet
+	recentKeys      *common.KeyWindow
+	spoolOpt        SpoolOpt
+
+	// quit stops the ingesting goroutines, running tracks them
+	quit    chan struct{}
+	running sync.WaitGroup
 
 	mu sync.Mutex
 }
 
 func NewStorage(
 	tradesRepo repository.Trades,
-	candles1mRepo repository.Candles1m,
-	tradeActivityCh chan entity.TradeActivityV2,
+	candlesRepo repository.Candles,
+	rollupSizes []time.Duration,
+	tradeActivityCh <-chan entity.TradeActivityV2,
+	tradeBackfillCh <-chan entity.TradeActivityV2,
+	spoolOpt SpoolOpt,
 ) *storage {
+	if spoolOpt.RetryInterval <= 0 {
+		spoolOpt.RetryInterval = 5 * time.Second
+	}
+
+	if spoolOpt.MaxRetryInterval < spoolOpt.RetryInterval {
+		spoolOpt.MaxRetryInterval = max(5*time.Minute, spoolOpt.RetryInterval)
+	}
+
+	if spoolOpt.ChunkSize <= 0 {
+		spoolOpt.ChunkSize = 5000
+	}
+
 	return &storage{
 		tradesRepo:      tradesRepo,
-		candles1mRepo:   candles1mRepo,
+		candlesRepo:     candlesRepo,
+		rollupSizes:     rollupSizes,
 		tradeActivityCh: tradeActivityCh,
+		tradeBackfillCh: tradeBackfillCh,
 		candle1mBuffer:  entity.Candle{},
 		tradesBuffer:    []entity.TradeActivityV2{},
+		recentKeys:      common.NewKeyWindow(200000),
+		spoolOpt:        spoolOpt,
+		quit:            make(chan struct{}),
 	}
 }
 
@@ -39,25 +82,193 @@ func (s *storage) Start() {
 	ctx := context.Background()
 	fullSignalCh := make(chan bool)
 
-	go s.ProcessTradesInBatch(ctx, fullSignalCh)
-	go s.IngestTradeActivity(ctx, fullSignalCh)
+	s.running.Add(2)
+
+	go func() {
+		defer s.running.Done()
+		s.ProcessTradesInBatch(ctx, fullSignalCh)
+	}()
+
+	go func() {
+		defer s.running.Done()
+		s.IngestTradeActivity(ctx, fullSignalCh)
+	}()
+
+	if s.spoolOpt.Spool != nil {
+		s.running.Add(1)
+
+		go func() {
+			defer s.running.Done()
+			s.replaySpool(ctx)
+		}()
+	}
+}
+
+// Shutdown stops ingesting, drains the trade channels and flushes what is
+// buffered. Adapters should be stopped first, so nothing new is published.
+// The report counts what could not be written before ctx was done.
+func (s *storage) Shutdown(ctx context.Context) entity.ShutdownReport {
+	close(s.quit)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		// a batch is still being written and takes care of its own trades,
+		// what is buffered besides it can only be spooled. The spool stays
+		// open for the running batch to spool into if it fails, but whether
+		// it gets there is not known when returning.
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		drained := s.drainTrades()
+
+		trades := s.tradesBuffer
+		s.tradesBuffer = []entity.TradeActivityV2{}
+
+		report := entity.ShutdownReport{
+			TradesDrained:     drained,
+			TradesUnconfirmed: s.inFlight,
+			TimedOut:          true,
+		}
+
+		if len(trades) > 0 {
+			if s.spoolTrades(trades) {
+				report.TradesSpooled = len(trades)
+			} else {
+				report.TradesLost = len(trades)
+			}
+		}
+
+		logrus.
+			WithError(ctx.Err()).
+			WithField("spooled", report.TradesSpooled).
+			WithField("lost", report.TradesLost).
+			WithField("unconfirmed", report.TradesUnconfirmed).
+			Error("[service][storage][Shutdown] timed out waiting for the running batch")
+
+		return report
+	}
+
+	defer s.closeSpool()
+
+	drained := s.drainTrades()
+
+	trades := s.tradesBuffer
+	s.tradesBuffer = []entity.TradeActivityV2{}
+
+	report := entity.ShutdownReport{
+		TradesDrained: drained,
+	}
+
+	if len(trades) == 0 {
+		return report
+	}
+
+	inserted, err := s.storeTrades(ctx, trades)
+	if err != nil {
+		if s.spoolTrades(trades) {
+			report.TradesSpooled = len(trades)
+		} else {
+			report.TradesLost = len(trades)
+		}
+	} else {
+		report.TradesFlushed = len(trades)
+	}
+
+	// spooled trades get their candles once replayed, but those stored before
+	// a failure are skipped by the replay and need theirs now
+	if len(inserted) > 0 {
+		n, err := s.update1mCandle(ctx, inserted)
+		if err != nil {
+			report.CandlesLost = n
+		}
+	}
+
+	report.TimedOut = ctx.Err() != nil
+
+	return report
+}
+
+// drainTrades moves what is left in the trade channels to the buffer and
+// returns how many trades it moved. Callers hold s.mu while the ingesting
+// goroutines may still run.
+func (s *storage) drainTrades() int {
+	drained := 0
+	activityCh, backfillCh := s.tradeActivityCh, s.tradeBackfillCh
+
+	for {
+		var trade entity.TradeActivityV2
+		var ok bool
+
+		select {
+		case trade, ok = <-activityCh:
+			if !ok {
+				activityCh = nil
+				continue
+			}
+		case trade, ok = <-backfillCh:
+			if !ok {
+				backfillCh = nil
+				continue
+			}
+		default:
+			return drained
+		}
+
+		if s.recentKeys.Seen(trade.Exchange + ":" + trade.Key) {
+			continue
+		}
+
+		s.tradesBuffer = append(s.tradesBuffer, trade)
+		drained++
+	}
 }
 
 func (s *storage) IngestTradeActivity(ctx context.Context, fullSignalCh chan bool) {
 	logrus.Info("[service][storage][IngestTradeActivity] ingesting trade activity")
 
 	for {
-		trade, ok := <-s.tradeActivityCh
+		var trade entity.TradeActivityV2
+		var ok bool
+
+		select {
+		case trade, ok = <-s.tradeActivityCh:
+		case trade, ok = <-s.tradeBackfillCh:
+		case <-s.quit:
+			return
+		}
+
 		if !ok {
 			logrus.
 				WithField("trade", fmt.Sprintf("%+v", trade)).
 				Warn("[service][storage][IngestTradeActivity] failed to read channel")
 		}
 
+		if s.recentKeys.Seen(trade.Exchange + ":" + trade.Key) {
+			logrus.
+				WithField("exchange", trade.Exchange).
+				WithField("key", trade.Key).
+				Debug("[service][storage][IngestTradeActivity] duplicate trade skipped")
+			continue
+		}
+
+		s.mu.Lock()
 		s.tradesBuffer = append(s.tradesBuffer, trade)
+		full := len(s.tradesBuffer) >= 100000
+		s.mu.Unlock()
 
-		if len(s.tradesBuffer) >= 100000 {
-			fullSignalCh <- true
+		if full {
+			select {
+			case fullSignalCh <- true:
+			case <-s.quit:
+				return
+			}
 		}
 	}
 }
@@ -66,11 +277,14 @@ func (s *storage) ProcessTradesInBatch(ctx context.Context, fullSignalCh chan bo
 	logrus.Info("[service][storage][IngestTradeActivity] ready to process trade activity")
 
 	ticker1m := time.NewTicker(time.Minute)
+	defer ticker1m.Stop()
 
 	for {
 		process := false
 
 		select {
+		case <-s.quit:
+			return
 		case <-ticker1m.C:
 			if len(s.tradesBuffer) > 0 {
 				process = true
@@ -88,153 +302,250 @@ func (s *storage) ProcessTradesInBatch(ctx context.Context, fullSignalCh chan bo
 		s.mu.Lock()
 		tradesCopy := append([]entity.TradeActivityV2(nil), s.tradesBuffer...)
 		s.tradesBuffer = []entity.TradeActivityV2{}
+		s.inFlight = len(tradesCopy)
+		s.mu.Unlock()
+
+		metrics.StorageBatchSize.Observe(float64(len(tradesCopy)))
+
+		start := time.Now()
+		inserted, err := s.storeTrades(ctx, tradesCopy)
+		metrics.StorageBatchDuration.WithLabelValues("store_trades").Observe(time.Since(start).Seconds())
+
+		// spooled trades get their candles once replayed, but those stored
+		// before a failure are skipped by the replay and need theirs now
+		if err != nil {
+			s.spoolTrades(tradesCopy)
+		}
+
+		s.mu.Lock()
+		s.inFlight = 0
 		s.mu.Unlock()
 
-		s.storeTrades(ctx, tradesCopy)
-		s.update1mCandle(ctx, tradesCopy)
+		if len(inserted) == 0 {
+			continue
+		}
+
+		start = time.Now()
+		s.update1mCandle(ctx, inserted)
+		metrics.StorageBatchDuration.WithLabelValues("update_candles").Observe(time.Since(start).Seconds())
 	}
 }
 
-func (s *storage) storeTrades(ctx context.Context, trades []entity.TradeActivityV2) {
-	err := s.tradesRepo.InsertMany(ctx, trades)
+// storeTrades returns the trades actually inserted, so candles are built only
+// from trades the database did not already hold, including on error those
+// stored before the failure.
+func (s *storage) storeTrades(ctx context.Context, trades []entity.TradeActivityV2) ([]entity.TradeActivityV2, error) {
+	inserted, err := s.tradesRepo.InsertMany(ctx, trades)
 	if err != nil {
 		logrus.
 			WithError(err).
+			WithField("inserted", len(inserted)).
 			Error("[service][storage][storeTrades][tradesRepo.InsertMany]")
-		return
+		return inserted, err
 	}
 
 	logrus.
 		WithField("length", len(trades)).
+		WithField("inserted", len(inserted)).
 		Info("[service][storage][storeTrades] trades stored")
+
+	return inserted, nil
 }
 
-func (s *storage) update1mCandle(ctx context.Context, trades []entity.TradeActivityV2) {
-	candleBuffers := map[string]map[string]map[time.Time]*entity.Candle{}
+// spoolTrades keeps trades that failed to be stored for the replay, and
+// reports whether they were kept.
+func (s *storage) spoolTrades(trades []entity.TradeActivityV2) bool {
+	if s.spoolOpt.Spool == nil {
+		return false
+	}
 
-	for _, trade := range trades {
-		exchangeCandles, ok := candleBuffers[trade.Exchange]
-		if !ok {
-			exchangeCandles = map[string]map[time.Time]*entity.Candle{}
-			candleBuffers[trade.Exchange] = exchangeCandles
-		}
+	err := s.spoolOpt.Spool.Append(trades)
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("length", len(trades)).
+			Error("[service][storage][spoolTrades][Spool.Append] trades lost")
+		return false
+	}
 
-		exchangeSymbolCandles, ok := exchangeCandles[trade.Symbol]
-		if !ok {
-			exchangeSymbolCandles = map[time.Time]*entity.Candle{}
-			exchangeCandles[trade.Symbol] = map[time.Time]*entity.Candle{}
+	logrus.
+		WithField("length", len(trades)).
+		Warn("[service][storage][spoolTrades] trades spooled")
+
+	return true
+}
+
+// replaySpool writes the spooled trades back to the database, starting right
+// away so what a previous run spooled is replayed on startup.
+func (s *storage) replaySpool(ctx context.Context) {
+	backoff := s.spoolOpt.RetryInterval
+
+	for {
+		n, err := s.spoolOpt.Spool.Replay(ctx, s.spoolOpt.ChunkSize, s.writeSpooled)
+		if n > 0 {
+			logrus.
+				WithField("length", n).
+				Info("[service][storage][replaySpool] spooled trades replayed")
 		}
 
-		tradeTime := time.Unix(trade.Epoch, 0)
-		normalizedTime := time.Date(tradeTime.Year(), tradeTime.Month(), tradeTime.Day(), tradeTime.Hour(), tradeTime.Minute(), 0, 0, tradeTime.Location())
+		wait := s.spoolOpt.RetryInterval
 
-		buf, ok := exchangeSymbolCandles[normalizedTime]
-		if !ok {
-			stored, err := s.candles1mRepo.GetOne(ctx, normalizedTime, trade.Exchange, trade.Symbol)
-			if err != nil {
-				logrus.
-					WithError(err).
-					WithField("exchange", trade.Exchange).
-					WithField("symbol", trade.Symbol).
-					WithField("time", normalizedTime.String()).
-					Error("[service][storage][update1mCandle][candles1mRepo.GetOne]")
+		if err != nil {
+			records, _ := s.spoolOpt.Spool.Size()
 
-				continue
-			}
+			logrus.
+				WithError(err).
+				WithField("spooled", records).
+				WithField("backoff", backoff.String()).
+				Warn("[service][storage][replaySpool][Spool.Replay]")
+
+			wait = backoff
+			backoff = min(backoff*2, s.spoolOpt.MaxRetryInterval)
+		} else {
+			backoff = s.spoolOpt.RetryInterval
+		}
 
-			if stored != nil {
-				stored.Dirty = true
-				buf = stored
-			}
+		select {
+		case <-time.After(wait):
+		case <-s.quit:
+			return
 		}
+	}
+}
 
-		if buf == nil {
-			buf = &entity.Candle{
-				Epoch:    normalizedTime.Unix(),
-				Exchange: trade.Exchange,
-				Open:     trade.Price,
-				High:     trade.Price,
-				Low:      trade.Price,
-				Close:    trade.Price,
-				Volume: entity.CandleVolume{
-					Total: trade.BaseVolume,
-				},
-			}
+func (s *storage) writeSpooled(ctx context.Context, trades []entity.TradeActivityV2) error {
+	inserted, insertErr := s.tradesRepo.InsertMany(ctx, trades)
 
-			switch trade.Side {
-			case entity.TradeSideBuy:
-				buf.Volume.Buy = trade.BaseVolume
-			case entity.TradeSideSell:
-				buf.Volume.Sell = trade.BaseVolume
-			}
+	// the trades inserted are stored even if the chunk failed, replaying it
+	// again would skip them and still leave their candles missing
+	n, err := s.update1mCandle(ctx, inserted)
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("trades", len(inserted)).
+			WithField("candles", n).
+			Error("[service][storage][writeSpooled][update1mCandle] candles of replayed trades lost")
+	}
 
-			exchangeSymbolCandles[normalizedTime] = buf
-			continue
-		}
+	if insertErr != nil {
+		return fmt.Errorf("[service][storage][writeSpooled][tradesRepo.InsertMany] %w", insertErr)
+	}
 
-		buf.Close = trade.Price
+	return nil
+}
 
-		buf.Volume.Total = buf.Volume.Total.Add(trade.BaseVolume)
+func (s *storage) closeSpool() {
+	if s.spoolOpt.Spool == nil {
+		return
+	}
 
-		switch trade.Side {
-		case entity.TradeSideBuy:
-			buf.Volume.Buy = buf.Volume.Buy.Add(trade.BaseVolume)
-		case entity.TradeSideSell:
-			buf.Volume.Sell = buf.Volume.Sell.Add(trade.BaseVolume)
-		}
+	err := s.spoolOpt.Spool.Close()
+	if err != nil {
+		logrus.
+			WithError(err).
+			Error("[service][storage][closeSpool][Spool.Close]")
+	}
+}
 
-		if trade.Price.GreaterThan(buf.High) {
-			buf.High = trade.Price
-		}
+// update1mCandle upserts the 1m candles of newly stored trades and folds them
+// into the rollups. It returns the number of 1m candles of the batch.
+func (s *storage) update1mCandle(ctx context.Context, trades []entity.TradeActivityV2) (int, error) {
+	candleBuffers := map[string]*entity.Candle{}
+	candles := []*entity.Candle{}
 
-		if trade.Price.LessThan(buf.Low) {
-			buf.Low = trade.Price
+	for _, trade := range trades {
+		bucket := trade.Epoch - (trade.Epoch % 60)
+		key := fmt.Sprintf("%s:%s:%d", trade.Exchange, trade.Symbol, bucket)
+
+		buf, ok := candleBuffers[key]
+		if !ok {
+			buf = &entity.Candle{}
+			common.InitCandle(buf, bucket, trade)
+
+			candleBuffers[key] = buf
+			candles = append(candles, buf)
+			continue
 		}
 
-		// candleBuffers[normalizedTime] = buf
+		common.UpdateOHLC(buf, trade)
+	}
+
+	if len(candles) == 0 {
+		return 0, nil
+	}
+
+	batch := make([]entity.Candle, 0, len(candles))
+	for _, candle := range candles {
+		batch = append(batch, *candle)
+	}
+
+	err := s.candlesRepo.UpsertMany(ctx, time.Minute, batch)
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("length", len(batch)).
+			Error("[service][storage][update1mCandle][candlesRepo.UpsertMany]")
+		return len(batch), err
 	}
 
-	for _, exchangeCandles := range candleBuffers {
-		for _, exchangeSymbolCandles := range exchangeCandles {
-			for _, candle := range exchangeSymbolCandles {
-				if candle.Dirty {
-					err := s.candles1mRepo.UpdateOne(ctx, *candle)
-					if err != nil {
-						logrus.
-							WithError(err).
-							WithField("exchange", candle.Exchange).
-							WithField("symbol", candle.Symbol).
-							WithField("time", time.Unix(candle.Epoch, 0).String()).
-							Error("[service][storage][update1mCandle][candles1mRepo.UpdateOne]")
-						continue
-					}
+	logrus.
+		WithField("length", len(batch)).
+		Info("[service][storage][update1mCandle] candles upserted")
+
+	s.updateCandleRollups(ctx, batch)
+
+	return len(batch), nil
+}
+
+// updateCandleRollups folds the 1m candles of a batch into every rollup
+// resolution, so larger candles grow by the same deltas as candles_1m.
+func (s *storage) updateCandleRollups(ctx context.Context, candles1m []entity.Candle) {
+	sort.SliceStable(candles1m, func(i, j int) bool {
+		return candles1m[i].Epoch < candles1m[j].Epoch
+	})
+
+	for _, size := range s.rollupSizes {
+		sizeSec := int64(size.Seconds())
 
-					logrus.
-						WithField("exchange", candle.Exchange).
-						WithField("symbol", candle.Symbol).
-						WithField("time", time.Unix(candle.Epoch, 0).String()).
-						Info("[service][storage][update1mCandle]  updated candle")
+		rollupBuffers := map[string]*entity.Candle{}
+		rollups := []*entity.Candle{}
 
-					continue
-				}
+		for _, candle := range candles1m {
+			bucket := candle.Epoch - (candle.Epoch % sizeSec)
+			key := fmt.Sprintf("%s:%s:%d", candle.Exchange, candle.Symbol, bucket)
 
-				err := s.candles1mRepo.InsertOne(ctx, *candle)
-				if err != nil {
-					logrus.
-						WithError(err).
-						WithField("exchange", candle.Exchange).
-						WithField("symbol", candle.Symbol).
-						WithField("time", time.Unix(candle.Epoch, 0).String()).
-						Error("[service][storage][update1mCandle][candles1mRepo.InsertOne]")
-					continue
-				}
+			buf, ok := rollupBuffers[key]
+			if !ok {
+				buf = &entity.Candle{}
+				*buf = candle
+				buf.Epoch = bucket
 
-				logrus.
-					WithField("exchange", candle.Exchange).
-					WithField("symbol", candle.Symbol).
-					WithField("time", time.Unix(candle.Epoch, 0).String()).
-					Info("[service][storage][update1mCandle] inserted candle")
+				rollupBuffers[key] = buf
+				rollups = append(rollups, buf)
+				continue
 			}
+
+			common.MergeCandle(buf, candle)
+		}
+
+		batch := make([]entity.Candle, 0, len(rollups))
+		for _, rollup := range rollups {
+			batch = append(batch, *rollup)
+		}
+
+		err := s.candlesRepo.UpsertMany(ctx, size, batch)
+		if err != nil {
+			logrus.
+				WithError(err).
+				WithField("size", common.FormatInterval(size)).
+				WithField("length", len(batch)).
+				Error("[service][storage][updateCandleRollups][candlesRepo.UpsertMany]")
+			continue
 		}
+
+		logrus.
+			WithField("size", common.FormatInterval(size)).
+			WithField("length", len(batch)).
+			Debug("[service][storage][updateCandleRollups] rollups upserted")
 	}
 }
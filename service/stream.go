@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"michaelyusak/go-market-ingestor.git/common"
 	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/metrics"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 
@@ -22,6 +24,8 @@ type streamHandler struct {
 
 	token string
 
+	symbols map[string]bool
+
 	cleanedAt time.Time
 }
 
@@ -31,23 +35,24 @@ type candleState struct {
 }
 
 type stream struct {
-	tradeActivityCh chan entity.TradeActivityV2
+	tradeActivityCh <-chan entity.TradeActivityV2
 
 	handlerMap map[string]streamHandler
 	handlerTtl time.Duration
 	tokenLen   int
 
-	candles map[string]*candleState
+	candles map[time.Duration]map[string]*candleState
 
 	candlesSubscribers map[string]map[string]chan []byte
 
 	listenedSymbols []string
+	listenedMu      sync.RWMutex
 
 	mu sync.Mutex
 }
 
 func NewStream(
-	tradeActivityCh chan entity.TradeActivityV2,
+	tradeActivityCh <-chan entity.TradeActivityV2,
 	listenedSymbols []string,
 ) *stream {
 	return &stream{
@@ -57,7 +62,7 @@ func NewStream(
 		handlerTtl: 24 * time.Hour,
 		tokenLen:   20,
 
-		candles: map[string]*candleState{},
+		candles: map[time.Duration]map[string]*candleState{},
 
 		candlesSubscribers: map[string]map[string]chan []byte{},
 
@@ -66,7 +71,48 @@ func NewStream(
 }
 
 func (s *stream) GetListenedSymbols() []string {
-	return s.listenedSymbols
+	s.listenedMu.RLock()
+	defer s.listenedMu.RUnlock()
+
+	return slices.Clone(s.listenedSymbols)
+}
+
+func (s *stream) AddListenedSymbols(symbols []string) {
+	s.listenedMu.Lock()
+	defer s.listenedMu.Unlock()
+
+	for _, symbol := range symbols {
+		if !slices.Contains(s.listenedSymbols, symbol) {
+			s.listenedSymbols = append(s.listenedSymbols, symbol)
+		}
+	}
+}
+
+// RemoveListenedSymbols stops accepting new subscriptions to symbols, drops
+// them from the streams already subscribed and discards their candle states.
+func (s *stream) RemoveListenedSymbols(symbols []string) {
+	// same lock order as updateSymbols, so a concurrent subscribe either
+	// lands before the removal and is pruned, or fails validation
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listenedMu.Lock()
+	s.listenedSymbols = slices.DeleteFunc(s.listenedSymbols, func(symbol string) bool {
+		return slices.Contains(symbols, symbol)
+	})
+	s.listenedMu.Unlock()
+
+	for _, handler := range s.handlerMap {
+		for _, symbol := range symbols {
+			delete(handler.symbols, symbol)
+		}
+	}
+
+	for _, states := range s.candles {
+		for _, symbol := range symbols {
+			delete(states, symbol)
+		}
+	}
 }
 
 func (s *stream) Start() {
@@ -88,19 +134,24 @@ func (s *stream) Start() {
 
 func (s *stream) handleTrade(trade entity.TradeActivityV2) {
 	s.mu.Lock()
-	candleS, ok := s.candles[trade.Exchange+":"+trade.Symbol]
-	if !ok {
-		candleS = &candleState{
-			candle: &entity.Candle{},
-			size:   time.Minute,
+	defer s.mu.Unlock()
+
+	symbol := trade.Exchange + ":" + trade.Symbol
+
+	for size, states := range s.candles {
+		candleS, ok := states[symbol]
+		if !ok {
+			candleS = &candleState{
+				candle: &entity.Candle{},
+				size:   size,
+			}
+			states[symbol] = candleS
 		}
-		s.candles[trade.Exchange+":"+trade.Symbol] = candleS
-	}
-	s.mu.Unlock()
 
-	closed := common.UpdateCandle(candleS.candle, candleS.size, trade)
-	if closed != nil {
-		s.emitCandle(*closed, candleS.size.String())
+		closed := common.UpdateCandle(candleS.candle, candleS.size, trade)
+		if closed != nil {
+			s.emitCandle(*closed, candleS.size.String())
+		}
 	}
 }
 
@@ -108,16 +159,19 @@ func (s *stream) handleTimeBoundary(now time.Time) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for _, state := range s.candles {
-		if state.candle.Epoch == 0 {
-			continue
-		}
+	for _, states := range s.candles {
+		for _, state := range states {
+			if state.candle.Epoch == 0 {
+				continue
+			}
 
-		bucket := now.Truncate(state.size).Unix()
+			sizeSec := int64(state.size.Seconds())
+			bucket := now.Unix() - (now.Unix() % sizeSec)
 
-		if bucket > state.candle.Epoch {
-			s.emitCandle(*state.candle, state.size.String())
-			s.rolloverCandle(state, bucket)
+			if bucket > state.candle.Epoch {
+				s.emitCandle(*state.candle, state.size.String())
+				s.rolloverCandle(state, bucket)
+			}
 		}
 	}
 }
@@ -148,10 +202,23 @@ func (s *stream) emitCandle(candle entity.Candle, size string) error {
 		return fmt.Errorf("[service][stream][emitCandle][json.Marshal] error: %w", err)
 	}
 
+	symbol := candle.Exchange + ":" + candle.Symbol
+
 	chs := s.candlesSubscribers[size]
 
 	for channel, ch := range chs {
-		ch <- data
+		if !s.handlerMap[channel].symbols[symbol] {
+			continue
+		}
+
+		if !s.send(ch, data, size) {
+			logrus.
+				WithField("channel", channel).
+				Warn("[service][stream][emitCandle] subscriber queue full, candle dropped")
+			continue
+		}
+
+		metrics.CandlesEmitted.WithLabelValues(size).Inc()
 		logrus.
 			WithField("channel", channel).
 			Info("[service][stream][emitCandle] candle emited")
@@ -160,6 +227,60 @@ func (s *stream) emitCandle(candle entity.Candle, size string) error {
 	return nil
 }
 
+// send never blocks: it runs under s.mu, and a slow websocket writer must not
+// stall candle updates, Stop or shutdown. A full queue drops the message.
+func (s *stream) send(ch chan []byte, data []byte, size string) bool {
+	select {
+	case ch <- data:
+		return true
+	default:
+		metrics.StreamMessagesDropped.WithLabelValues(size).Inc()
+		return false
+	}
+}
+
+// SendAlert forwards a stale-data alert to every subscriber of its symbol,
+// wrapped in a WsMessage so clients can tell it from candles.
+func (s *stream) SendAlert(alert entity.StaleAlert) error {
+	alertData, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("[service][stream][SendAlert][json.Marshal(alert)] error: %w", err)
+	}
+
+	data, err := json.Marshal(entity.WsMessage{
+		Type: string(entity.WsMessageTypeAlert),
+		Data: alertData,
+	})
+	if err != nil {
+		return fmt.Errorf("[service][stream][SendAlert][json.Marshal] error: %w", err)
+	}
+
+	symbol := alert.Exchange + ":" + alert.Symbol
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a channel gets the alert once, whichever sizes it appears under
+	alerted := map[string]bool{}
+
+	for size, chs := range s.candlesSubscribers {
+		for channel, ch := range chs {
+			if alerted[channel] || !s.handlerMap[channel].symbols[symbol] {
+				continue
+			}
+			alerted[channel] = true
+
+			if !s.send(ch, data, size) {
+				logrus.
+					WithField("channel", channel).
+					Warn("[service][stream][SendAlert] subscriber queue full, alert dropped")
+			}
+		}
+	}
+
+	return nil
+}
+
 func (s *stream) runStreamHandlerCleaner() {
 	tic := time.NewTicker(time.Hour)
 
@@ -187,7 +308,47 @@ func (s *stream) cleanStreamHandler() {
 	s.handlerMap = newMap
 }
 
+func (s *stream) validateSymbols(symbols []string) error {
+	s.listenedMu.RLock()
+	defer s.listenedMu.RUnlock()
+
+	for _, symbol := range symbols {
+		if !slices.Contains(s.listenedSymbols, symbol) {
+			return apperror.BadRequestError(apperror.AppErrorOpt{
+				Message:         fmt.Sprintf("[service][stream][validateSymbols] symbol not listened: %s", symbol),
+				ResponseMessage: fmt.Sprintf("symbol not listened: %s", symbol),
+			})
+		}
+	}
+
+	return nil
+}
+
 func (s *stream) CreateCandleStream(ctx context.Context, req entity.CreateStreamReq) (entity.CreateStreamRes, error) {
+	size := time.Duration(req.CandleSize)
+	if size < time.Second || size%time.Second != 0 {
+		return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Message:         fmt.Sprintf("[service][stream][CreateCandleStream] invalid candle size: %s", size.String()),
+			ResponseMessage: "candle size must be a whole number of seconds",
+		})
+	}
+
+	reqSymbols := req.Symbols
+	if len(reqSymbols) == 0 {
+		// no symbols means every symbol listened at creation time
+		reqSymbols = s.GetListenedSymbols()
+	}
+
+	err := s.validateSymbols(reqSymbols)
+	if err != nil {
+		return entity.CreateStreamRes{}, err
+	}
+
+	symbols := map[string]bool{}
+	for _, symbol := range reqSymbols {
+		symbols[symbol] = true
+	}
+
 	channelHash := helper.HashSHA512(fmt.Sprintf("%s%v", time.Duration(req.CandleSize).String(), time.Now().UnixMilli()))
 	channel := fmt.Sprintf("ch:%s", channelHash)
 
@@ -197,6 +358,7 @@ func (s *stream) CreateCandleStream(ctx context.Context, req entity.CreateStream
 	s.handlerMap[channel] = streamHandler{
 		candleSize: req.CandleSize,
 		token:      token,
+		symbols:    symbols,
 		cleanedAt:  time.Now().Add(s.handlerTtl),
 	}
 	s.mu.Unlock()
@@ -231,7 +393,8 @@ func (s *stream) StreamCandles(ctx context.Context, ch chan []byte, channel, tok
 		})
 	}
 
-	sizeStr := time.Duration(handler.candleSize).String()
+	size := time.Duration(handler.candleSize)
+	sizeStr := size.String()
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -240,6 +403,12 @@ func (s *stream) StreamCandles(ctx context.Context, ch chan []byte, channel, tok
 		s.candlesSubscribers[sizeStr] = map[string]chan []byte{}
 	}
 	s.candlesSubscribers[sizeStr][channel] = ch
+	metrics.StreamSubscribers.WithLabelValues(sizeStr).Set(float64(len(s.candlesSubscribers[sizeStr])))
+
+	_, ok = s.candles[size]
+	if !ok {
+		s.candles[size] = map[string]*candleState{}
+	}
 
 	logrus.
 		WithField("channel", channel).
@@ -272,11 +441,24 @@ func (s *stream) Stop(channel, token string) error {
 		})
 	}
 
-	size := time.Duration(handler.candleSize).String()
-	if chList, ok := s.candlesSubscribers[size]; ok {
-		ch := chList[channel]
-		delete(chList, channel)
-		close(ch)
+	size := time.Duration(handler.candleSize)
+	if chList, ok := s.candlesSubscribers[size.String()]; ok {
+		// the handler may never have started streaming, and closing the nil
+		// channel a missing entry yields would panic
+		if ch, ok := chList[channel]; ok {
+			delete(chList, channel)
+			close(ch)
+		}
+		metrics.StreamSubscribers.WithLabelValues(size.String()).Set(float64(len(chList)))
+
+		if len(chList) == 0 {
+			delete(s.candlesSubscribers, size.String())
+			delete(s.candles, size)
+
+			logrus.
+				WithField("size", size.String()).
+				Info("[service][stream][Stop] last subscriber left, candle states dropped")
+		}
 	}
 
 	logrus.
@@ -285,3 +467,59 @@ func (s *stream) Stop(channel, token string) error {
 
 	return nil
 }
+
+func (s *stream) Subscribe(channel, token string, symbols []string) error {
+	return s.updateSymbols(channel, token, symbols, true)
+}
+
+func (s *stream) Unsubscribe(channel, token string, symbols []string) error {
+	return s.updateSymbols(channel, token, symbols, false)
+}
+
+func (s *stream) updateSymbols(channel, token string, symbols []string, subscribe bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	handler, ok := s.handlerMap[channel]
+
+	if !ok {
+		logrus.Warn("[service][stream][updateSymbols] stream not found")
+
+		return apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:    http.StatusNotFound,
+			Message: "[service][stream][updateSymbols] stream not found",
+		})
+	}
+
+	if handler.token != token {
+		logrus.Warn("[service][stream][updateSymbols] invalid token")
+
+		return apperror.UnauthorizedError(apperror.AppErrorOpt{
+			Message: "[service][stream][updateSymbols] invalid token",
+		})
+	}
+
+	if subscribe {
+		err := s.validateSymbols(symbols)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, symbol := range symbols {
+		if subscribe {
+			handler.symbols[symbol] = true
+			continue
+		}
+
+		delete(handler.symbols, symbol)
+	}
+
+	logrus.
+		WithField("channel", channel).
+		WithField("symbols", symbols).
+		WithField("subscribe", subscribe).
+		Info("[service][stream][updateSymbols] symbols updated")
+
+	return nil
+}
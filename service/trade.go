@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+)
+
+type trade struct {
+	tradesRepo repository.Trades
+
+	defaultLimit int
+	maxLimit     int
+	defaultRange time.Duration
+}
+
+func NewTrade(
+	tradesRepo repository.Trades,
+) *trade {
+	return &trade{
+		tradesRepo: tradesRepo,
+
+		defaultLimit: 500,
+		maxLimit:     5000,
+		defaultRange: time.Hour,
+	}
+}
+
+func (s *trade) GetTrades(ctx context.Context, req entity.GetTradesReq) (entity.GetTradesRes, error) {
+	query := entity.TradesQuery{
+		Exchange: req.Exchange,
+		Symbol:   req.Symbol,
+	}
+
+	switch entity.TradeSide(req.Side) {
+	case "", entity.TradeSideBuy, entity.TradeSideSell:
+		query.Side = entity.TradeSide(req.Side)
+	default:
+		return entity.GetTradesRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Message:         fmt.Sprintf("[service][trade][GetTrades] invalid side: %s", req.Side),
+			ResponseMessage: "side must be buy or sell",
+		})
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = s.defaultLimit
+	}
+	limit = min(limit, s.maxLimit)
+
+	to := req.To
+	if to == 0 {
+		to = time.Now().Unix()
+	}
+
+	from := req.From
+	if from == 0 {
+		from = to - int64(s.defaultRange.Seconds())
+	}
+
+	if from >= to {
+		return entity.GetTradesRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Message:         fmt.Sprintf("[service][trade][GetTrades] invalid range: from %d to %d", from, to),
+			ResponseMessage: "from must be before to",
+		})
+	}
+
+	if req.Cursor != "" {
+		epoch, key, err := decodeTradeCursor(req.Cursor)
+		if err != nil {
+			return entity.GetTradesRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+				Message:         fmt.Sprintf("[service][trade][GetTrades][decodeTradeCursor] %s", err.Error()),
+				ResponseMessage: "invalid cursor",
+			})
+		}
+
+		query.AfterEpoch = epoch
+		query.AfterKey = key
+	}
+
+	query.From = time.Unix(from, 0)
+	query.To = time.Unix(to, 0)
+	query.Limit = limit + 1
+
+	trades, err := s.tradesRepo.GetMany(ctx, query)
+	if err != nil {
+		return entity.GetTradesRes{}, fmt.Errorf("[service][trade][GetTrades][tradesRepo.GetMany] %w", err)
+	}
+
+	res := entity.GetTradesRes{
+		Trades: trades,
+	}
+
+	if len(trades) > limit {
+		res.Trades = trades[:limit]
+
+		last := res.Trades[limit-1]
+		res.NextCursor = encodeTradeCursor(last.Epoch, last.Key)
+	}
+
+	return res, nil
+}
+
+func encodeTradeCursor(epoch int64, key string) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%s", epoch, key))
+}
+
+func decodeTradeCursor(cursor string) (int64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid cursor encoding: %w", err)
+	}
+
+	epochStr, key, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return 0, "", fmt.Errorf("invalid cursor format")
+	}
+
+	epoch, err := strconv.ParseInt(epochStr, 10, 64)
+	if err != nil || epoch <= 0 {
+		return 0, "", fmt.Errorf("invalid cursor epoch")
+	}
+
+	return epoch, key, nil
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-market-ingestor.git/adapter/exchange"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/sirupsen/logrus"
+)
+
+type WatchdogOpt struct {
+	CheckInterval     time.Duration
+	DefaultMaxSilence time.Duration
+	// MaxSilence overrides DefaultMaxSilence per exchange:symbol, for pairs
+	// that are quiet by nature
+	MaxSilence map[string]time.Duration
+	// a stale pair is alerted and resubscribed at most once per cooldown
+	AlertCooldown  time.Duration
+	WebhookUrl     string
+	WebhookTimeout time.Duration
+}
+
+type watchdog struct {
+	tradeActivityCh <-chan entity.TradeActivityV2
+	streamService   Stream
+	resubscribers   map[string]exchange.Resubscriber
+	webhookClient   *resty.Client
+
+	opt WatchdogOpt
+
+	lastTrade map[string]time.Time // exchange:symbol -> last trade seen
+	// exchange:symbol -> when the watchdog started watching it, the silence
+	// of a symbol without trades counts from there
+	watchedAt map[string]time.Time
+	alertedAt map[string]time.Time
+
+	mu sync.Mutex
+}
+
+func NewWatchdog(
+	tradeActivityCh <-chan entity.TradeActivityV2,
+	streamService Stream,
+	resubscribers map[string]exchange.Resubscriber,
+	opt WatchdogOpt,
+) *watchdog {
+	if opt.CheckInterval <= 0 {
+		opt.CheckInterval = time.Minute
+	}
+
+	if opt.DefaultMaxSilence <= 0 {
+		opt.DefaultMaxSilence = 15 * time.Minute
+	}
+
+	if opt.AlertCooldown <= 0 {
+		opt.AlertCooldown = opt.DefaultMaxSilence
+	}
+
+	if opt.WebhookTimeout <= 0 {
+		opt.WebhookTimeout = 10 * time.Second
+	}
+
+	return &watchdog{
+		tradeActivityCh: tradeActivityCh,
+		streamService:   streamService,
+		resubscribers:   resubscribers,
+		webhookClient:   resty.New().SetTimeout(opt.WebhookTimeout),
+
+		opt: opt,
+
+		lastTrade: map[string]time.Time{},
+		watchedAt: map[string]time.Time{},
+		alertedAt: map[string]time.Time{},
+	}
+}
+
+func (s *watchdog) Start() {
+	s.watch(time.Now())
+
+	go s.trackTrades()
+	go s.runChecks()
+}
+
+func (s *watchdog) trackTrades() {
+	for trade := range s.tradeActivityCh {
+		s.mu.Lock()
+		s.lastTrade[trade.Exchange+":"+trade.Symbol] = time.Now()
+		s.mu.Unlock()
+	}
+}
+
+func (s *watchdog) runChecks() {
+	logrus.
+		WithField("interval", s.opt.CheckInterval.String()).
+		WithField("default_max_silence", s.opt.DefaultMaxSilence.String()).
+		Info("[service][watchdog][runChecks] watching listened symbols")
+
+	ticker := time.NewTicker(s.opt.CheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, alert := range s.findStale(now) {
+			s.handleStale(alert)
+		}
+	}
+}
+
+// watch starts watching the symbols listened since the last call at now, and
+// forgets those no longer listened, so a pair added at runtime, or removed and
+// added again, is not judged by what happened before.
+func (s *watchdog) watch(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbols := s.streamService.GetListenedSymbols()
+
+	for _, symbol := range symbols {
+		if _, ok := s.watchedAt[symbol]; !ok {
+			s.watchedAt[symbol] = now
+		}
+	}
+
+	for symbol := range s.watchedAt {
+		if slices.Contains(symbols, symbol) {
+			continue
+		}
+
+		delete(s.watchedAt, symbol)
+		delete(s.lastTrade, symbol)
+		delete(s.alertedAt, symbol)
+	}
+
+	return symbols
+}
+
+// findStale returns an alert for every listened symbol silent for longer than
+// its max silence and not alerted within the cooldown.
+func (s *watchdog) findStale(now time.Time) []entity.StaleAlert {
+	symbols := s.watch(now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alerts := []entity.StaleAlert{}
+
+	for _, symbol := range symbols {
+		maxSilence, ok := s.opt.MaxSilence[symbol]
+		if !ok {
+			maxSilence = s.opt.DefaultMaxSilence
+		}
+
+		lastSeen, traded := s.lastTrade[symbol]
+		if !traded {
+			lastSeen = s.watchedAt[symbol]
+		}
+
+		silentFor := now.Sub(lastSeen)
+		if silentFor <= maxSilence {
+			continue
+		}
+
+		if alertedAt, ok := s.alertedAt[symbol]; ok && now.Sub(alertedAt) < s.opt.AlertCooldown {
+			continue
+		}
+		s.alertedAt[symbol] = now
+
+		exchangeName, pair, _ := strings.Cut(symbol, ":")
+
+		alert := entity.StaleAlert{
+			Exchange:   exchangeName,
+			Symbol:     pair,
+			SilentFor:  silentFor.Truncate(time.Second).String(),
+			MaxSilence: maxSilence.String(),
+			RaisedAt:   now.Unix(),
+		}
+		if traded {
+			alert.LastTradeAt = lastSeen.Unix()
+		}
+
+		alerts = append(alerts, alert)
+	}
+
+	return alerts
+}
+
+func (s *watchdog) handleStale(alert entity.StaleAlert) {
+	resubscriber, ok := s.resubscribers[alert.Exchange]
+	if ok {
+		err := resubscriber.Resubscribe(alert.Symbol)
+		if err != nil {
+			alert.Error = err.Error()
+		} else {
+			alert.Resubscribed = true
+		}
+	}
+
+	logrus.
+		WithField("exchange", alert.Exchange).
+		WithField("symbol", alert.Symbol).
+		WithField("last_trade_at", alert.LastTradeAt).
+		WithField("silent_for", alert.SilentFor).
+		WithField("max_silence", alert.MaxSilence).
+		WithField("resubscribed", alert.Resubscribed).
+		WithField("error", alert.Error).
+		Warn("[service][watchdog][handleStale] symbol looks stale")
+
+	err := s.streamService.SendAlert(alert)
+	if err != nil {
+		logrus.
+			WithError(err).
+			Warn("[service][watchdog][handleStale][streamService.SendAlert]")
+	}
+
+	if s.opt.WebhookUrl == "" {
+		return
+	}
+
+	err = s.postWebhook(context.Background(), alert)
+	if err != nil {
+		logrus.
+			WithError(err).
+			Warn("[service][watchdog][handleStale][postWebhook]")
+	}
+}
+
+func (s *watchdog) postWebhook(ctx context.Context, alert entity.StaleAlert) error {
+	res, err := s.webhookClient.R().
+		SetContext(ctx).
+		SetBody(alert).
+		Post(s.opt.WebhookUrl)
+	if err != nil {
+		return fmt.Errorf("[service][watchdog][postWebhook][webhookClient.Post] %w", err)
+	}
+
+	if res.StatusCode() >= http.StatusMultipleChoices {
+		return fmt.Errorf("[service][watchdog][postWebhook] unexpected status %d [raw: %s]", res.StatusCode(), res.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"michaelyusak/go-market-ingestor.git/entity"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type stubStream struct {
+	Stream
+
+	symbols []string
+	mu      sync.Mutex
+}
+
+func (s *stubStream) GetListenedSymbols() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.symbols)
+}
+
+func (s *stubStream) setSymbols(symbols ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.symbols = symbols
+}
+
+func staleSymbols(alerts []entity.StaleAlert) []string {
+	symbols := []string{}
+
+	for _, alert := range alerts {
+		symbols = append(symbols, alert.Exchange+":"+alert.Symbol)
+	}
+
+	return symbols
+}
+
+func TestWatchdogFindStale(t *testing.T) {
+	stream := &stubStream{}
+	stream.setSymbols("indodax:btcidr", "indodax:ethidr")
+
+	s := NewWatchdog(nil, stream, nil, WatchdogOpt{DefaultMaxSilence: 10 * time.Minute})
+
+	start := time.Now()
+	s.watch(start)
+
+	// ethidr traded recently, btcidr never did
+	s.lastTrade["indodax:ethidr"] = start.Add(5 * time.Minute)
+
+	got := staleSymbols(s.findStale(start.Add(11 * time.Minute)))
+	if !slices.Equal(got, []string{"indodax:btcidr"}) {
+		t.Errorf("stale = %v, want [indodax:btcidr]", got)
+	}
+
+	// alerted within the cooldown
+	if got := s.findStale(start.Add(12 * time.Minute)); len(got) != 0 {
+		t.Errorf("stale = %v, want none within the cooldown", staleSymbols(got))
+	}
+}
+
+func TestWatchdogPairAddedAtRuntime(t *testing.T) {
+	stream := &stubStream{}
+	stream.setSymbols("indodax:btcidr")
+
+	s := NewWatchdog(nil, stream, nil, WatchdogOpt{DefaultMaxSilence: 10 * time.Minute})
+
+	start := time.Now()
+	s.watch(start)
+	s.lastTrade["indodax:btcidr"] = start.Add(2*time.Hour + 5*time.Minute)
+
+	// added hours after startup, without a trade yet
+	stream.setSymbols("indodax:btcidr", "indodax:ethidr")
+
+	if got := s.findStale(start.Add(2 * time.Hour)); len(got) != 0 {
+		t.Fatalf("stale = %v, want none right after the pair was added", staleSymbols(got))
+	}
+
+	got := staleSymbols(s.findStale(start.Add(2*time.Hour + 11*time.Minute)))
+	if !slices.Equal(got, []string{"indodax:ethidr"}) {
+		t.Errorf("stale = %v, want [indodax:ethidr] once silent for longer than max silence", got)
+	}
+}
+
+func TestWatchdogPairReAdded(t *testing.T) {
+	stream := &stubStream{}
+	stream.setSymbols("indodax:btcidr")
+
+	s := NewWatchdog(nil, stream, nil, WatchdogOpt{DefaultMaxSilence: 10 * time.Minute})
+
+	start := time.Now()
+	s.watch(start)
+	s.lastTrade["indodax:btcidr"] = start
+
+	stream.setSymbols()
+	s.findStale(start.Add(time.Hour))
+
+	stream.setSymbols("indodax:btcidr")
+
+	if got := s.findStale(start.Add(2 * time.Hour)); len(got) != 0 {
+		t.Errorf("stale = %v, want the last trade before removal forgotten", staleSymbols(got))
+	}
+}
@@ -0,0 +1,388 @@
+package spool
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"michaelyusak/go-market-ingestor.git/entity"
+	"michaelyusak/go-market-ingestor.git/metrics"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxRecordSize guards against reading a corrupted length prefix.
+const maxRecordSize = 1 << 20
+
+// Spool is an append-only file of trades that could not be written to the
+// database. Every record is a 4 byte big endian length followed by the JSON
+// of one trade.
+//
+// Appends go to the active file. A replay moves the active file aside to
+// <path>.replay and reads it from there, so appends never wait on the
+// database; whatever a failed replay did not get through stays in the replay
+// file for the next one.
+type Spool struct {
+	path string
+	file *os.File
+
+	// records and size cover both files
+	records int
+	size    int64
+
+	mu       sync.Mutex
+	replayMu sync.Mutex
+}
+
+func Open(path string) (*Spool, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("[spool][Open][os.MkdirAll] %w", err)
+	}
+
+	s := &Spool{
+		path: path,
+	}
+
+	for _, p := range []string{s.replayPath(), path} {
+		records, size, err := count(p)
+		if err != nil {
+			return nil, fmt.Errorf("[spool][Open][count] %s: %w", p, err)
+		}
+
+		s.records += records
+		s.size += size
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("[spool][Open][os.OpenFile] %w", err)
+	}
+	s.file = file
+
+	s.report()
+
+	return s, nil
+}
+
+func (s *Spool) replayPath() string {
+	return s.path + ".replay"
+}
+
+// Size returns the number of trades spooled and the size of the files.
+func (s *Spool) Size() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.records, s.size
+}
+
+// Append writes trades to the active file and syncs it.
+func (s *Spool) Append(trades []entity.TradeActivityV2) error {
+	var buf []byte
+
+	for _, trade := range trades {
+		data, err := json.Marshal(trade)
+		if err != nil {
+			return fmt.Errorf("[spool][Append][json.Marshal] %w", err)
+		}
+
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+		buf = append(buf, data...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.file.Write(buf)
+	if err != nil {
+		return fmt.Errorf("[spool][Append][file.Write] %w", err)
+	}
+
+	err = s.file.Sync()
+	if err != nil {
+		return fmt.Errorf("[spool][Append][file.Sync] %w", err)
+	}
+
+	s.records += len(trades)
+	s.size += int64(len(buf))
+	s.report()
+
+	metrics.SpoolTrades.WithLabelValues("append").Add(float64(len(trades)))
+
+	return nil
+}
+
+// Replay hands the spooled trades to write in chunks of up to chunkSize, oldest
+// first, and drops them once written. It stops at the first error, keeping
+// the trades not written for the next replay, and returns how many were.
+func (s *Spool) Replay(ctx context.Context, chunkSize int, write func(ctx context.Context, trades []entity.TradeActivityV2) error) (int, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	err := s.rotate()
+	if err != nil {
+		return 0, fmt.Errorf("[spool][Replay][rotate] %w", err)
+	}
+
+	file, err := os.Open(s.replayPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("[spool][Replay][os.Open] %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	replayed := 0
+	var offset int64
+
+	for {
+		chunk, n, readErr := readChunk(reader, chunkSize)
+
+		if len(chunk) > 0 {
+			err := write(ctx, chunk)
+			if err != nil {
+				compactErr := s.compact(file, offset)
+				if compactErr != nil {
+					return replayed, errors.Join(err, fmt.Errorf("[spool][Replay][compact] %w", compactErr))
+				}
+
+				return replayed, err
+			}
+
+			offset += n
+			replayed += len(chunk)
+			s.drop(len(chunk), n)
+
+			metrics.SpoolTrades.WithLabelValues("replay").Add(float64(len(chunk)))
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+
+		if readErr != nil {
+			// a record cut short by a crash, nothing after it can be read
+			logrus.
+				WithError(readErr).
+				WithField("offset", offset).
+				Warn("[spool][Replay][readChunk] dropping unreadable spool tail")
+			break
+		}
+	}
+
+	file.Close()
+
+	err = os.Remove(s.replayPath())
+	if err != nil {
+		return replayed, fmt.Errorf("[spool][Replay][os.Remove] %w", err)
+	}
+
+	// the unreadable tail, if any, is gone with the file
+	s.mu.Lock()
+	activeRecords, activeSize, _ := count(s.path)
+	s.records, s.size = activeRecords, activeSize
+	s.report()
+	s.mu.Unlock()
+
+	return replayed, nil
+}
+
+// rotate moves the active file aside for replay, unless a previous replay
+// left one behind or there is nothing to replay.
+func (s *Spool) rotate() error {
+	_, err := os.Stat(s.replayPath())
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() == 0 {
+		return nil
+	}
+
+	err = s.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(s.path, s.replayPath())
+	if err != nil {
+		return err
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+
+	return err
+}
+
+// compact rewrites the replay file without the records before offset.
+func (s *Spool) compact(file *os.File, offset int64) error {
+	if offset == 0 {
+		return nil
+	}
+
+	_, err := file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.replayPath() + ".tmp"
+
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, file)
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.replayPath())
+}
+
+func (s *Spool) drop(records int, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records -= records
+	s.size -= size
+	s.report()
+}
+
+// report publishes the size of the spool. The caller must hold s.mu.
+func (s *Spool) report() {
+	metrics.SpoolRecords.Set(float64(s.records))
+	metrics.SpoolBytes.Set(float64(s.size))
+}
+
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// readChunk reads up to size trades and the bytes they took.
+func readChunk(reader *bufio.Reader, size int) ([]entity.TradeActivityV2, int64, error) {
+	trades := []entity.TradeActivityV2{}
+	var n int64
+
+	for len(trades) < size {
+		data, err := readRecord(reader)
+		if err != nil {
+			return trades, n, err
+		}
+
+		var trade entity.TradeActivityV2
+		err = json.Unmarshal(data, &trade)
+		if err != nil {
+			return trades, n, fmt.Errorf("[spool][readChunk][json.Unmarshal] %w", err)
+		}
+
+		trades = append(trades, trade)
+		n += int64(4 + len(data))
+	}
+
+	return trades, n, nil
+}
+
+// readRecord returns io.EOF only at a record boundary.
+func readRecord(reader *bufio.Reader) ([]byte, error) {
+	var header [4]byte
+
+	_, err := io.ReadFull(reader, header[:])
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("[spool][readRecord] truncated length: %w", err)
+		}
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[:])
+	if length > maxRecordSize {
+		return nil, fmt.Errorf("[spool][readRecord] invalid record length %d", length)
+	}
+
+	data := make([]byte, length)
+
+	_, err = io.ReadFull(reader, data)
+	if err != nil {
+		return nil, fmt.Errorf("[spool][readRecord] truncated record: %w", err)
+	}
+
+	return data, nil
+}
+
+// count returns the readable records of a spool file and their size. A tail
+// cut short by a crash is truncated, so later appends stay readable.
+func count(path string) (int, int64, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	reader := bufio.NewReader(file)
+
+	records := 0
+	var size int64
+
+	for {
+		data, err := readRecord(reader)
+		if err != nil {
+			break
+		}
+
+		records++
+		size += int64(4 + len(data))
+	}
+
+	if size < info.Size() {
+		logrus.
+			WithField("path", path).
+			WithField("dropped_bytes", info.Size()-size).
+			Warn("[spool][count] truncating unreadable spool tail")
+
+		err = os.Truncate(path, size)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return records, size, nil
+}